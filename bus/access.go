@@ -2,35 +2,253 @@ package bus
 
 import (
 	"fmt"
+	"sort"
 )
 
-// Filter bus by node types.
-func (b *Bus) Filter(types []string) *Bus {
-	tlookup := make(map[string]bool, len(types))
-	for _, t := range types {
+// FilterOptions configure how a bus is filtered.
+type FilterOptions struct {
+	// Types of nodes to keep.
+	Types []string
+
+	// Side of roles to keep. If SideBoth, roles on all sides are kept.
+	Side Side
+
+	// Closure keeps every node reachable from a kept node through binds
+	// and node values, directly or indirectly. Nodes kept only because
+	// they are reachable are marked read-only, see Node.ReadOnly.
+	// Node values are only followed on an initialized bus.
+	Closure bool
+
+	// Extension keeps only the scripts of the extension.
+	// If empty, all scripts are kept.
+	Extension string
+}
+
+// Filter bus by node types and side.
+// Roles that are not on the given side are removed from both node types
+// and nodes. If side is SideBoth, roles on all sides are kept.
+// The base node types of each node type are kept, but not their nodes.
+// The returned bus shares no nodes, roles, fields, or field KV maps with
+// the original bus and must be initialized before use.
+func (b *Bus) Filter(types []string, side Side) *Bus {
+	return b.FilterWith(FilterOptions{Types: types, Side: side})
+}
+
+// FilterWith is the same as Filter, but with the given options.
+func (b *Bus) FilterWith(opts FilterOptions) *Bus {
+	if b == nil {
+		return nil
+	}
+	side := opts.Side
+	tlookup := make(map[string]bool, len(opts.Types))
+	for _, t := range opts.Types {
 		tlookup[t] = true
 	}
+	byName := make(map[string]*NodeType, len(b.Types))
+	for i := range b.Types {
+		byName[b.Types[i].Name] = &b.Types[i]
+	}
+	// kept is true for each kept node name, false for a read-only node.
+	kept := make(map[string]bool, len(b.Nodes))
+	for _, n := range b.Nodes {
+		if tlookup[n.Type] {
+			kept[n.Name] = true
+		}
+	}
+	if opts.Closure {
+		byNodeName := make(map[string]*Node, len(b.Nodes))
+		for ni := range b.Nodes {
+			n := &b.Nodes[ni]
+			byNodeName[n.Name] = n
+			for _, alt := range n.NameAlt {
+				byNodeName[alt] = n
+			}
+		}
+		var queue []*Node
+		for ni := range b.Nodes {
+			if kept[b.Nodes[ni].Name] {
+				queue = append(queue, &b.Nodes[ni])
+			}
+		}
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+			for _, name := range b.references(n) {
+				ref, ok := byNodeName[name]
+				if !ok {
+					continue
+				}
+				if _, seen := kept[ref.Name]; seen {
+					continue
+				}
+				kept[ref.Name] = false
+				queue = append(queue, ref)
+			}
+		}
+	}
+
+	// keepBase marks the node type and each base node type to be kept and
+	// records the side filter of each declared and inherited role in keep.
+	keepType := make(map[string]bool, len(opts.Types))
+	var keepBase func(name string, keep, visited map[string]bool)
+	keepBase = func(name string, keep, visited map[string]bool) {
+		nt, ok := byName[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		keepType[name] = true
+		for _, rt := range nt.Roles {
+			keep[rt.Name] = rt.Side.on(side)
+		}
+		for _, base := range nt.Extends {
+			keepBase(base, keep, visited)
+		}
+	}
 
 	f := &Bus{
-		Version: b.Version,
-		Nodes:   make([]Node, 0, len(b.Nodes)),
-		Types:   make([]NodeType, 0, len(types)),
+		Version:      b.Version,
+		Nodes:        make([]Node, 0, len(b.Nodes)),
+		Types:        make([]NodeType, 0, len(opts.Types)),
+		externalType: make(map[string]string),
+	}
+	for _, sc := range b.Scripts {
+		if len(opts.Extension) == 0 || sc.Extension == opts.Extension {
+			f.Scripts = append(f.Scripts, sc)
+		}
+	}
+	// keepRole by type name and role name.
+	keepRole := make(map[string]map[string]bool, len(opts.Types))
+	addType := func(t string) {
+		if _, ok := keepRole[t]; ok {
+			return
+		}
+		keep := make(map[string]bool)
+		keepRole[t] = keep
+		keepBase(t, keep, make(map[string]bool))
+	}
+	for _, t := range opts.Types {
+		addType(t)
 	}
 	for _, n := range b.Nodes {
-		if !tlookup[n.Type] {
-			continue
+		if k, ok := kept[n.Name]; ok && !k {
+			addType(n.Type)
 		}
-		f.Nodes = append(f.Nodes, n)
 	}
 	for _, t := range b.Types {
-		if !tlookup[t.Name] {
+		if !keepType[t.Name] {
+			continue
+		}
+		keep := make(map[string]bool, len(t.Roles))
+		for _, rt := range t.Roles {
+			keep[rt.Name] = rt.Side.on(side)
+		}
+		f.Types = append(f.Types, t.copy(keep))
+	}
+	for _, n := range b.Nodes {
+		k, ok := kept[n.Name]
+		if !ok {
+			f.externalType[n.Name] = n.Type
+			for _, alt := range n.NameAlt {
+				f.externalType[alt] = n.Type
+			}
 			continue
 		}
-		f.Types = append(f.Types, t)
+		c := n.copy(keepRole[n.Type])
+		c.readOnly = !k
+		f.Nodes = append(f.Nodes, c)
 	}
 	return f
 }
 
+// references returns the names of the nodes the node refers to. Node values
+// are only returned if the bus is initialized.
+func (b *Bus) references(n *Node) []string {
+	if b.setup {
+		return n.ToNode()
+	}
+	ret := make([]string, 0, len(n.Binds))
+	for _, bd := range n.Binds {
+		ret = append(ret, bd.Name)
+	}
+	return ret
+}
+
+// on reports if a role on side s should be included when requesting side.
+func (s Side) on(side Side) bool {
+	return side == SideBoth || s == SideBoth || s == side
+}
+
+// copy the NodeType, excluding any role set to false in keep.
+func (nt NodeType) copy(keep map[string]bool) NodeType {
+	c := NodeType{
+		Name:    nt.Name,
+		Extends: nt.Extends,
+		Roles:   make([]RoleType, 0, len(nt.Roles)),
+		Meta:    nt.Meta,
+
+		Version:    nt.Version,
+		Migrations: nt.Migrations,
+	}
+	for _, rt := range nt.Roles {
+		if k, ok := keep[rt.Name]; ok && !k {
+			continue
+		}
+		rt.Properties = append([]Property(nil), rt.Properties...)
+		rt.propNameLookup = nil
+		c.Roles = append(c.Roles, rt)
+	}
+	return c
+}
+
+// copy the Node, excluding any role set to false in keep.
+func (n Node) copy(keep map[string]bool) Node {
+	c := Node{
+		Name:    n.Name,
+		NameAlt: append([]string(nil), n.NameAlt...),
+		Type:    n.Type,
+		Roles:   make([]Role, 0, len(n.Roles)),
+		Binds:   make([]Bind, len(n.Binds)),
+		Package: n.Package,
+		Meta:    n.Meta,
+
+		readOnly: n.readOnly,
+	}
+	if n.Labels != nil {
+		c.Labels = make(map[string]string, len(n.Labels))
+		for k, v := range n.Labels {
+			c.Labels[k] = v
+		}
+	}
+	for i, bd := range n.Binds {
+		c.Binds[i] = Bind{Alias: bd.Alias, Name: bd.Name}
+	}
+	for _, r := range n.Roles {
+		if k, ok := keep[r.Name]; ok && !k {
+			continue
+		}
+		cr := Role{
+			Name:   r.Name,
+			Fields: make([]Field, len(r.Fields)),
+		}
+		for fi, f := range r.Fields {
+			cr.Fields[fi] = Field{
+				ID:    f.ID,
+				Alias: f.Alias,
+			}
+			if f.KV != nil {
+				kv := make(KV, len(f.KV))
+				for k, v := range f.KV {
+					kv[k] = v
+				}
+				cr.Fields[fi].KV = kv
+			}
+		}
+		c.Roles = append(c.Roles, cr)
+	}
+	return c
+}
+
 // Node returns a *Node by name.
 func (b *Bus) Node(name string) *Node {
 	if b == nil {
@@ -39,6 +257,32 @@ func (b *Bus) Node(name string) *Node {
 	return b.nodeLookup[name]
 }
 
+// IsExternal reports if the node name is referenced from the bus, but the
+// node is not present in the bus. Only a bus initialized with
+// InitOptions.AllowExternal may have external nodes.
+func (b *Bus) IsExternal(name string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := b.externalLookup[name]
+	return ok
+}
+
+// External returns the placeholder nodes for all external node references.
+func (b *Bus) External() []*Node {
+	if b == nil {
+		return nil
+	}
+	ret := make([]*Node, 0, len(b.externalLookup))
+	for _, n := range b.externalLookup {
+		ret = append(ret, n)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
 func (b *Bus) NodeByType(typeName ...string) []*Node {
 	if b == nil {
 		return nil
@@ -64,6 +308,16 @@ func (nt *NodeType) RoleType(name string) *RoleType {
 	return nt.roleLookup[name]
 }
 
+// hasRecv reports if any property in the role type has Recv set.
+func (rt *RoleType) hasRecv() bool {
+	for _, pr := range rt.Properties {
+		if pr.Recv {
+			return true
+		}
+	}
+	return false
+}
+
 // Property returns the Property name.
 func (rt *RoleType) Property(name string) *Property {
 	return rt.propNameLookup[name]
@@ -74,6 +328,30 @@ func (p *Property) DefaultValue() interface{} {
 	return p.defaultValue
 }
 
+// External reports if the node is a placeholder for a node that is not
+// present in the bus. A placeholder node has a name, the type if known,
+// and no roles or binds.
+func (n *Node) External() bool {
+	return n.external
+}
+
+// renamedFrom reports if name is an alternate name of the node.
+func (n *Node) renamedFrom(name string) bool {
+	for _, alt := range n.NameAlt {
+		if alt == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnly reports if the node was kept by Filter only because a handled
+// node refers to it. A read-only node is context to resolve references and
+// is not handled by the consumer of the filtered bus.
+func (n *Node) ReadOnly() bool {
+	return n.readOnly
+}
+
 // NodeType returns the associated NodeType to the Node.
 func (n *Node) NodeType() *NodeType {
 	return n.nodeType
@@ -108,14 +386,48 @@ func (f *Field) Name() string {
 	return f.name
 }
 
-func (f *Field) needUpdate(prev *Field) bool {
-	// TODO(daniel.theophanes): This is probably overly simple, but may work for now.
-	for fkey, fvalue := range f.values {
-		if prev.values[fkey] != fvalue {
-			return true
+// sortedKeys returns the keys of kv in sorted order.
+func sortedKeys(kv KV) []string {
+	keys := make([]string, 0, len(kv))
+	for key := range kv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PropertyChange is a changed property value of a field.
+type PropertyChange struct {
+	Key      string
+	Previous interface{}
+	Current  interface{}
+}
+
+// Compare the normalized values of the field to the values of the previous
+// field and return each changed property, ordered by key. A property
+// present in only one of the fields is compared to a nil value.
+// Node values are equal if they have the same name, or if the current node
+// was renamed from the previous node.
+func (f *Field) Compare(prev *Field) []PropertyChange {
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	for key := range prev.values {
+		if _, ok := f.values[key]; !ok {
+			keys = append(keys, key)
 		}
 	}
-	return false
+	sort.Strings(keys)
+	var changes []PropertyChange
+	for _, key := range keys {
+		cv, pv := f.values[key], prev.values[key]
+		if valueEqual(cv, pv) {
+			continue
+		}
+		changes = append(changes, PropertyChange{Key: key, Previous: pv, Current: cv})
+	}
+	return changes
 }
 
 // Node returns the associated Node to the Bind.
@@ -0,0 +1,228 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+	"solidcoredata.org/src/databus/bus/load"
+)
+
+func TestFilterSide(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/test",
+            Roles: [
+                {Name: "both", Properties: [{Name: "name", Type: "text"}]},
+                {Name: "left", Side: 1, Properties: [{Name: "name", Type: "text"}]},
+                {Name: "right", Side: 2, Properties: [{Name: "name", Type: "text"}]},
+            ],
+        },
+        {
+            Name: "solidcoredata.org/other",
+            Roles: [
+                {Name: "both", Properties: [{Name: "name", Type: "text"}]},
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "node1",
+            Type: "solidcoredata.org/test",
+            Roles: [
+                {Name: "both", Fields: [{KV: {name: "b"}}]},
+                {Name: "left", Fields: [{KV: {name: "l"}}]},
+                {Name: "right", Fields: [{KV: {name: "r"}}]},
+            ],
+        },
+        {
+            Name: "node2",
+            Type: "solidcoredata.org/other",
+            Roles: [
+                {Name: "both", Fields: [{KV: {name: "b"}}]},
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	if err = b.Init(); err != nil {
+		t.Fatal("validate", err)
+	}
+
+	list := []struct {
+		Side  bus.Side
+		Roles []string
+	}{
+		{bus.SideBoth, []string{"both", "left", "right"}},
+		{bus.SideLeft, []string{"both", "left"}},
+		{bus.SideRight, []string{"both", "right"}},
+	}
+	for _, item := range list {
+		f := b.Filter([]string{"solidcoredata.org/test"}, item.Side)
+		if err = f.Init(); err != nil {
+			t.Fatalf("side %d: %v", item.Side, err)
+		}
+		if len(f.Nodes) != 1 {
+			t.Fatalf("side %d: expected one node, got %d", item.Side, len(f.Nodes))
+		}
+		n := f.Node("node1")
+		got := make([]string, 0, len(n.Roles))
+		for _, r := range n.Roles {
+			got = append(got, r.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(item.Roles, ",") {
+			t.Errorf("side %d: got roles %v want %v", item.Side, got, item.Roles)
+		}
+		if f.Node("node1").Role("both") == b.Node("node1").Role("both") {
+			t.Errorf("side %d: filtered bus shares roles with original", item.Side)
+		}
+		f.Node("node1").Role("both").Fields[0].KV["name"] = "changed"
+		if g := b.Node("node1").Role("both").Fields[0].KV["name"]; g != "b" {
+			t.Errorf("side %d: filtered bus shares field KV with original, got %v", item.Side, g)
+		}
+	}
+}
+
+func TestFilterExternal(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/test/table",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true, Send: true},
+                        {Name: "fk", Type: "node", Optional: true},
+                    ],
+                },
+            ],
+        },
+        {
+            Name: "solidcoredata.org/test/ui",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", Recv: true},
+                    ],
+                },
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "genre",
+            Type: "solidcoredata.org/test/table",
+            Roles: [
+                {Name: "schema", Fields: [{KV: {name: "id"}}]},
+            ],
+        },
+        {
+            Name: "book",
+            Type: "solidcoredata.org/test/table",
+            Roles: [
+                {Name: "schema", Fields: [{KV: {name: "genre", fk: "genre"}}]},
+            ],
+        },
+        {
+            Name: "ui",
+            Type: "solidcoredata.org/test/ui",
+            Roles: [
+                {Name: "schema", Fields: [{Alias: "b", KV: {name: "genre"}}]},
+            ],
+            Binds: [
+                {Alias: "b", Name: "book"},
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	if err = b.Init(); err != nil {
+		t.Fatal("validate", err)
+	}
+
+	ui := b.Filter([]string{"solidcoredata.org/test/ui"}, bus.SideBoth)
+	err = ui.Init()
+	if !errors.Is(err, bus.CodeBindNode) {
+		t.Fatalf("expected %q error, got %v", bus.CodeBindNode, err)
+	}
+
+	ui = b.Filter([]string{"solidcoredata.org/test/ui"}, bus.SideBoth)
+	if err = ui.InitWith(bus.InitOptions{AllowExternal: true}); err != nil {
+		t.Fatal("partial", err)
+	}
+	if !ui.IsExternal("book") {
+		t.Fatal("expected book to be external")
+	}
+	if ui.Node("book") != nil {
+		t.Fatal("external node should not be returned from Node")
+	}
+	bound := ui.Node("ui").BindAlias("b").Node()
+	if !bound.External() || bound.Type != "solidcoredata.org/test/table" {
+		t.Fatalf("expected typed external node, got %#v", bound)
+	}
+
+	tables := b.Filter([]string{"solidcoredata.org/test/table"}, bus.SideBoth)
+	if err = tables.InitWith(bus.InitOptions{AllowExternal: true}); err != nil {
+		t.Fatal("tables", err)
+	}
+	if len(tables.External()) != 0 {
+		t.Fatalf("expected no external nodes, got %d", len(tables.External()))
+	}
+	fk := tables.Node("book").Role("schema").Fields[0].Value("fk").(*bus.Node)
+	if fk != tables.Node("genre") {
+		t.Fatal("expected fk to resolve within the filtered bus")
+	}
+
+	// The closure includes the bound table and the table it refers to.
+	ui = b.FilterWith(bus.FilterOptions{Types: []string{"solidcoredata.org/test/ui"}, Closure: true})
+	if err = ui.Init(); err != nil {
+		t.Fatal("closure", err)
+	}
+	for _, name := range []string{"book", "genre"} {
+		n := ui.Node(name)
+		if n == nil {
+			t.Fatalf("expected %q in closure", name)
+		}
+		if !n.ReadOnly() {
+			t.Fatalf("expected %q to be read-only", name)
+		}
+	}
+	if ui.Node("ui").ReadOnly() {
+		t.Fatal("handled node should not be read-only")
+	}
+	if g := ui.Node("ui").Role("schema").Fields[0].Value("name"); g != "genre" {
+		t.Fatalf("got name %v", g)
+	}
+
+	// A delta between closures only includes handled nodes.
+	prev := b.FilterWith(bus.FilterOptions{Types: []string{"solidcoredata.org/test/ui"}, Closure: true})
+	delta, err := bus.NewDelta(ui, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range delta.Actions {
+		if (a.NodeCurrent != nil && a.NodeCurrent.ReadOnly()) || (a.NodePrevious != nil && a.NodePrevious.ReadOnly()) {
+			t.Fatalf("action %d on read-only node", a.Alter)
+		}
+	}
+
+}
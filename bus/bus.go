@@ -2,6 +2,10 @@
 // data types.
 package bus
 
+import (
+	"regexp"
+)
+
 // Side each role is on: a "left" side or "right" side.
 // The default is to have each role apply to both sides.
 type Side byte
@@ -30,29 +34,65 @@ type Bus struct {
 	Types []NodeType
 	Nodes []Node
 
+	// Scripts are the author supplied migration scripts, see Script.
+	Scripts []Script
+
 	// setup is true after the lookup fields are setup.
 	setup bool
+	// opts used to setup the bus.
+	opts InitOptions
 
 	nodeLookup map[string]*Node
 	typeLookup map[string]*NodeType
 	nodeByType map[string][]*Node // map[NodeType.Name][]*Node
+
+	// externalType is the node type by node name of each node removed by Filter.
+	externalType map[string]string
+	// externalLookup contains the placeholder nodes for references to nodes not in the bus.
+	externalLookup map[string]*Node
+	// warnings found during setup.
+	warnings *Errors
 }
 
 // Version of the Bus.
 type Version struct {
 	Version int64
 
-	// TODO(daniel.theophanes): This should really be a unique hash string and a sequence int64.
-	Sequence   int64
+	Sequence int64
+
+	// Identifier is the SHA-512 hash of the bus content, see Bus.Hash.
+	// It is set when the bus is committed.
 	Identifier [64]byte
 }
 
 // NodeType defines the types for nodes.
+//
+// A NodeType may extend one or more base node types, listed in order in
+// Extends. The roles of each base are inherited, then the roles of the
+// node type itself are applied. A role of the same name as an inherited
+// role must have the same Side and FieldCount. Its properties are added
+// to the inherited role, and a property of the same name replaces the
+// inherited property. A replaced property must keep the Type and FieldName
+// and may not make a required property optional.
 type NodeType struct {
-	Name  string
-	Roles []RoleType
+	Name    string
+	Extends []string
+	Roles   []RoleType
+
+	// Version of the node type. Increment the version when adding a migration.
+	Version int64
+	// Migrations upgrade the nodes of prior node type versions, see Bus.Migrate.
+	Migrations []Migration
+
+	Meta
 
+	// roles are the declared and inherited roles.
+	roles []RoleType
+	// bases are the names of all node types extended directly or indirectly.
+	bases      map[string]bool
 	roleLookup map[string]*RoleType
+	// derive are the properties with a default expression in evaluation order.
+	derive []derivation
 }
 
 // RoleType is the role type in a specific NodeType.
@@ -69,6 +109,12 @@ type RoleType struct {
 }
 
 // Property of a RoleType. Each property is an aspect of a single "column".
+//
+// The property Type is one of "text", "int", "float", "bool", "decimal", "bytes",
+// "node", "date", "timestamp", "uuid", "json", or "enum". A list of any type
+// other then "node" is declared with a "[]" prefix, such as "[]text".
+// Dates and timestamps are written in RFC 3339 format.
+//
 // To define a node with 5 "columns", where each column has a "name" and a "size",
 // Then the RoleType would define two properties: "name" and "size" and the
 // Role would define 5 Fields, each with two key value pairs.
@@ -81,8 +127,27 @@ type Property struct {
 	Recv      bool
 	Default   interface{}
 
+	// DefaultExpr derives the default value from other values of the node,
+	// such as "$.bind.display ?? $.field.name". A property may have either a
+	// Default or a DefaultExpr. See the expression grammar in derive.go.
+	DefaultExpr string
+
+	// Enum lists the allowed values for the "enum" and "[]enum" types.
+	Enum []string
+
+	// Value constraints. A property that is not Optional requires a value
+	// after defaults and received values are applied. Received values are
+	// checked against the constraints of the receiving property.
+	Min       *float64 // Minimum numeric value.
+	Max       *float64 // Maximum numeric value.
+	MaxLength int64    // Maximum runes in text, bytes in bytes, or items in a list. Zero is unlimited.
+	Pattern   string   // Regular expression text values must match.
+	NodeTypes []string // Allowed NodeType names of node values, or node types that extend them. Empty allows any node type.
+
 	// defaultValue is logically the same as Default, but normalized and typed.
 	defaultValue interface{}
+	pattern      *regexp.Regexp
+	expr         expr
 }
 
 // Node is an instance of a NodeType.
@@ -93,7 +158,14 @@ type Node struct {
 	Roles   []Role
 	Binds   []Bind
 
+	// Package the node was defined in, see Merge.
+	Package string
+
+	Meta
+
 	names           []string
+	external        bool
+	readOnly        bool
 	nodeType        *NodeType
 	roleLookup      map[string]*Role
 	bindAliasLookup map[string]*Bind
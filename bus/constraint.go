@@ -0,0 +1,122 @@
+package bus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/apd/v2"
+)
+
+// initConstraint checks the property constraints are valid for the property type.
+func (pr *Property) initConstraint() error {
+	pr.pattern = nil
+
+	base := strings.TrimPrefix(pr.Type, listPrefix)
+	isList := base != pr.Type
+
+	if pr.Min != nil || pr.Max != nil {
+		switch base {
+		default:
+			return fmt.Errorf("Min and Max not allowed on type %q", pr.Type)
+		case "int", "float", "decimal":
+		}
+		if pr.Min != nil && pr.Max != nil && *pr.Min > *pr.Max {
+			return fmt.Errorf("Min %v is greater then Max %v", *pr.Min, *pr.Max)
+		}
+	}
+	if pr.MaxLength < 0 {
+		return fmt.Errorf("MaxLength %d may not be negative", pr.MaxLength)
+	}
+	if pr.MaxLength > 0 && !isList {
+		switch base {
+		default:
+			return fmt.Errorf("MaxLength not allowed on type %q", pr.Type)
+		case "text", "bytes", "enum":
+		}
+	}
+	if len(pr.Pattern) > 0 {
+		switch base {
+		default:
+			return fmt.Errorf("Pattern not allowed on type %q", pr.Type)
+		case "text", "enum":
+		}
+		re, err := regexp.Compile(pr.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid Pattern: %w", err)
+		}
+		pr.pattern = re
+	}
+	if len(pr.NodeTypes) > 0 && pr.Type != "node" {
+		return fmt.Errorf("NodeTypes not allowed on type %q", pr.Type)
+	}
+	return nil
+}
+
+// checkConstraint checks a normalized value against the property constraints.
+func (pr *Property) checkConstraint(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	list, isList := v.([]interface{})
+	if !isList {
+		return pr.checkElem(v, true)
+	}
+	if pr.MaxLength > 0 && int64(len(list)) > pr.MaxLength {
+		return fmt.Errorf("list has %d items, more then MaxLength %d", len(list), pr.MaxLength)
+	}
+	for i, item := range list {
+		if err := pr.checkElem(item, false); err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (pr *Property) checkElem(v interface{}, checkLength bool) error {
+	var length int
+	var num *float64
+	switch v := v.(type) {
+	case string:
+		length = utf8.RuneCountInString(v)
+		if pr.pattern != nil && !pr.pattern.MatchString(v) {
+			return fmt.Errorf("value %q does not match Pattern %q", v, pr.Pattern)
+		}
+	case []byte:
+		length = len(v)
+	case int64:
+		f := float64(v)
+		num = &f
+	case float64:
+		num = &v
+	case *apd.Decimal:
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		num = &f
+	case *Node:
+		if len(pr.NodeTypes) == 0 || len(v.Type) == 0 {
+			break
+		}
+		for _, nt := range pr.NodeTypes {
+			if v.IsA(nt) {
+				return nil
+			}
+		}
+		return fmt.Errorf("node %q type %q must be one of %q", v.Name, v.Type, pr.NodeTypes)
+	}
+	if checkLength && pr.MaxLength > 0 && int64(length) > pr.MaxLength {
+		return fmt.Errorf("length %d is more then MaxLength %d", length, pr.MaxLength)
+	}
+	if num != nil {
+		if pr.Min != nil && *num < *pr.Min {
+			return fmt.Errorf("value %v is less then Min %v", *num, *pr.Min)
+		}
+		if pr.Max != nil && *num > *pr.Max {
+			return fmt.Errorf("value %v is greater then Max %v", *num, *pr.Max)
+		}
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 package bus
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
 // DeltaBus needs to handle the following changes:
 //  * New Node
 //  * Remove Node
@@ -9,6 +15,8 @@ package bus
 //    - Remove Role Field
 //    - Update Role Field
 //    - Rename Role Field
+//    - Reorder Role Field
+//  * Add or Remove Node Role
 type DeltaBus struct {
 	Current  *Bus
 	Previous *Bus
@@ -17,11 +25,25 @@ type DeltaBus struct {
 
 type DeltaAction struct {
 	Alter         Alter
+	Role          string // Role name of a role or field action.
 	NodeCurrent   *Node
 	NodePrevious  *Node
 	FieldCurrent  *Field
 	FieldPrevious *Field
 	Script        string
+
+	// Changes of each property of an AlterFieldUpdate.
+	Changes []PropertyChange
+
+	// Position and PositionPrevious are the field index in the current
+	// and previous role of an AlterFieldReorder.
+	Position         int
+	PositionPrevious int
+
+	// DataLoss is set if the action removes a node, role, or field, which
+	// discards the data stored for it. Whether an update, such as a smaller
+	// column, discards data depends on the extension.
+	DataLoss bool
 }
 
 type Alter int32
@@ -36,8 +58,47 @@ const (
 	AlterFieldRemove
 	AlterFieldRename
 	AlterFieldUpdate
+	AlterRoleAdd      // Role added to a node. The fields of the role are not added separately.
+	AlterRoleRemove   // Role removed from a node. The fields of the role are not removed separately.
+	AlterFieldReorder // Field moved relative to the other fields of the role.
 )
 
+var alterName = [...]string{
+	AlterNothing:      "nothing",
+	AlterScript:       "script",
+	AlterNodeAdd:      "node-add",
+	AlterNodeRemove:   "node-remove",
+	AlterNodeRename:   "node-rename",
+	AlterFieldAdd:     "field-add",
+	AlterFieldRemove:  "field-remove",
+	AlterFieldRename:  "field-rename",
+	AlterFieldUpdate:  "field-update",
+	AlterRoleAdd:      "role-add",
+	AlterRoleRemove:   "role-remove",
+	AlterFieldReorder: "field-reorder",
+}
+
+func (a Alter) String() string {
+	if a < 0 || int(a) >= len(alterName) {
+		return "alter(" + strconv.Itoa(int(a)) + ")"
+	}
+	return alterName[a]
+}
+
+func (a Alter) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Alter) UnmarshalText(text []byte) error {
+	for i, name := range alterName {
+		if name == string(text) {
+			*a = Alter(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("bus: unknown alter %q", text)
+}
+
 func NewDelta(current, previous *Bus) (*DeltaBus, error) {
 	var err error
 	err = current.Init()
@@ -52,8 +113,12 @@ func NewDelta(current, previous *Bus) (*DeltaBus, error) {
 		Current:  current,
 		Previous: previous,
 	}
+	var changes, removes []DeltaAction
 	add := func(da DeltaAction) {
-		db.Actions = append(db.Actions, da)
+		changes = append(changes, da)
+	}
+	remove := func(da DeltaAction) {
+		removes = append(removes, da)
 	}
 	// Calculate node and field level actions.
 	// List through all nodes and first determine node removals, additions, and renames.
@@ -61,15 +126,24 @@ func NewDelta(current, previous *Bus) (*DeltaBus, error) {
 	// to determine field addtions , removals, then renames.
 	// Lastly determine field level updates.
 	//
-	// Pre-additions scripts.
+	// Before scripts.
 	// Node additions.
 	// Node renames
+	// Role additions.
 	// Field additions.
 	// Field Renames.
 	// Field Updates.
+	// Field Reorders.
+	// Before-remove scripts.
 	// Field Removals.
+	// Role Removals.
 	// Node Removals.
-	// Post-removals scripts.
+	// After scripts.
+
+	previousOf, err := previousNodes(db.Current, db.Previous)
+	if err != nil {
+		return nil, err
+	}
 
 	type NodeCP struct {
 		Current  *Node
@@ -79,7 +153,10 @@ func NewDelta(current, previous *Bus) (*DeltaBus, error) {
 	nodeCurrentWithPrevious := make([]NodeCP, 0, len(db.Current.Nodes))
 	for ni := range db.Current.Nodes {
 		nc := &db.Current.Nodes[ni]
-		np := db.Previous.Node(nc.Name)
+		if nc.readOnly {
+			continue
+		}
+		np := previousOf[nc]
 		if np == nil {
 			add(DeltaAction{
 				Alter:       AlterNodeAdd,
@@ -100,32 +177,38 @@ func NewDelta(current, previous *Bus) (*DeltaBus, error) {
 		}
 	}
 
-	// Field additions and
+	// Role and field additions, field renames, updates, and reorders.
 	for _, cp := range nodeCurrentWithPrevious {
 		for ri := range cp.Current.Roles {
 			rc := &cp.Current.Roles[ri]
 			rp := cp.Previous.Role(rc.Name)
+			if rp == nil {
+				add(DeltaAction{
+					Alter:        AlterRoleAdd,
+					Role:         rc.Name,
+					NodeCurrent:  cp.Current,
+					NodePrevious: cp.Previous,
+				})
+				continue
+			}
+			prevIndex := make(map[*Field]int, len(rp.Fields))
+			for fi := range rp.Fields {
+				prevIndex[&rp.Fields[fi]] = fi
+			}
+			// Matched fields in current order.
+			type fieldCP struct {
+				current, previous *Field
+				index             int
+			}
+			var matched []fieldCP
+			var positions []int
 			for fi := range rc.Fields {
 				fc := &rc.Fields[fi]
-				var fp *Field
-				if rp == nil {
-					add(DeltaAction{
-						Alter:        AlterFieldAdd,
-						NodeCurrent:  cp.Current,
-						NodePrevious: cp.Previous,
-						FieldCurrent: fc,
-					})
-					continue
-				}
-				if fc.ID > 0 {
-					fp = rp.fieldIDLookup[fc.ID]
-				}
-				if fp == nil {
-					fp = rp.fieldNameLookup[fc.name]
-				}
+				fp := matchField(rc, fc, rp)
 				if fp == nil {
 					add(DeltaAction{
 						Alter:        AlterFieldAdd,
+						Role:         rc.Name,
 						NodeCurrent:  cp.Current,
 						NodePrevious: cp.Previous,
 						FieldCurrent: fc,
@@ -135,77 +218,284 @@ func NewDelta(current, previous *Bus) (*DeltaBus, error) {
 				if fc.name != fp.name {
 					add(DeltaAction{
 						Alter:         AlterFieldRename,
+						Role:          rc.Name,
 						NodeCurrent:   cp.Current,
 						NodePrevious:  cp.Previous,
 						FieldCurrent:  fc,
 						FieldPrevious: fp,
 					})
 				}
-				if fc.needUpdate(fp) {
+				if changes := fc.Compare(fp); len(changes) > 0 {
 					add(DeltaAction{
 						Alter:         AlterFieldUpdate,
+						Role:          rc.Name,
 						NodeCurrent:   cp.Current,
 						NodePrevious:  cp.Previous,
 						FieldCurrent:  fc,
 						FieldPrevious: fp,
+						Changes:       changes,
 					})
 				}
+				matched = append(matched, fieldCP{current: fc, previous: fp, index: fi})
+				positions = append(positions, prevIndex[fp])
+			}
+			for i, moved := range movedPositions(positions) {
+				if !moved {
+					continue
+				}
+				add(DeltaAction{
+					Alter:            AlterFieldReorder,
+					Role:             rc.Name,
+					NodeCurrent:      cp.Current,
+					NodePrevious:     cp.Previous,
+					FieldCurrent:     matched[i].current,
+					FieldPrevious:    matched[i].previous,
+					Position:         matched[i].index,
+					PositionPrevious: positions[i],
+				})
 			}
 		}
 		// Field removals.
 		for ri := range cp.Previous.Roles {
 			rp := &cp.Previous.Roles[ri]
 			rc := cp.Current.Role(rp.Name)
+			if rc == nil {
+				remove(DeltaAction{
+					Alter:        AlterRoleRemove,
+					DataLoss:     true,
+					Role:         rp.Name,
+					NodeCurrent:  cp.Current,
+					NodePrevious: cp.Previous,
+				})
+				continue
+			}
 			for fi := range rp.Fields {
 				fp := &rp.Fields[fi]
-
-				if rc == nil {
-					add(DeltaAction{
-						Alter:         AlterFieldRemove,
-						NodeCurrent:   cp.Current,
-						NodePrevious:  cp.Previous,
-						FieldPrevious: fp,
-					})
-					continue
-				}
-
-				var fc *Field
-				if fp.ID > 0 {
-					fc = rc.fieldIDLookup[fp.ID]
-				}
-				if fc == nil {
-					fc = rc.fieldNameLookup[fp.name]
-				}
-				if fc == nil {
-					add(DeltaAction{
+				if fc := matchField(rp, fp, rc); fc == nil {
+					remove(DeltaAction{
 						Alter:         AlterFieldRemove,
+						DataLoss:      true,
+						Role:          rp.Name,
 						NodeCurrent:   cp.Current,
 						NodePrevious:  cp.Previous,
 						FieldPrevious: fp,
 					})
-					continue
 				}
 			}
 		}
 	}
-	if db.Previous == nil {
-		return db, nil
-	}
 	// Node removals.
-	for ni := range db.Previous.Nodes {
-		np := &db.Previous.Nodes[ni]
-		nc := db.Current.Node(np.Name)
-		if nc == nil {
-			add(DeltaAction{
-				Alter:        AlterNodeRemove,
-				NodePrevious: np,
-			})
-			continue
+	if db.Previous != nil {
+		hasCurrent := make(map[*Node]bool, len(previousOf))
+		for _, np := range previousOf {
+			hasCurrent[np] = true
+		}
+		for ni := range db.Previous.Nodes {
+			np := &db.Previous.Nodes[ni]
+			if np.readOnly {
+				continue
+			}
+			if !hasCurrent[np] {
+				remove(DeltaAction{
+					Alter:        AlterNodeRemove,
+					DataLoss:     true,
+					NodePrevious: np,
+				})
+			}
 		}
 	}
+
+	db.Actions = append(db.Actions, db.scriptActions(ScriptBefore)...)
+	db.Actions = append(db.Actions, changes...)
+	db.Actions = append(db.Actions, db.scriptActions(ScriptBeforeRemove)...)
+	db.Actions = append(db.Actions, removes...)
+	db.Actions = append(db.Actions, db.scriptActions(ScriptAfter)...)
 	return db, nil
 }
 
-func (*DeltaBus) String() string {
-	panic("TODO")
+// Invert returns the delta from the current bus back to the previous bus.
+// Additions become removals, removals become additions, renames and
+// reorders are turned back, and updates restore the previous values.
+// Actions are ordered as NewDelta orders them, so node renames are turned
+// back before the fields of the node change. Removals are in the reverse
+// order of the additions they undo, so a node is removed before the nodes
+// it refers to.
+//
+// An inverted action that removes a node, role, or field has DataLoss set,
+// as the data stored since the forward delta was applied is lost. An
+// inverted update may also lose data, such as when a column is made smaller
+// again; the extension decides. Author scripts only run forward and are
+// left out.
+func (db *DeltaBus) Invert() *DeltaBus {
+	inv := &DeltaBus{
+		Current:  db.Previous,
+		Previous: db.Current,
+		Actions:  make([]DeltaAction, 0, len(db.Actions)),
+	}
+	list := make([]DeltaAction, 0, len(db.Actions))
+	for _, a := range db.Actions {
+		if a.Alter == AlterScript {
+			continue
+		}
+		ia := DeltaAction{
+			Alter:            a.Alter,
+			Role:             a.Role,
+			NodeCurrent:      a.NodePrevious,
+			NodePrevious:     a.NodeCurrent,
+			FieldCurrent:     a.FieldPrevious,
+			FieldPrevious:    a.FieldCurrent,
+			Position:         a.PositionPrevious,
+			PositionPrevious: a.Position,
+		}
+		switch a.Alter {
+		case AlterNodeAdd:
+			ia.Alter, ia.DataLoss = AlterNodeRemove, true
+		case AlterNodeRemove:
+			ia.Alter = AlterNodeAdd
+		case AlterRoleAdd:
+			ia.Alter, ia.DataLoss = AlterRoleRemove, true
+		case AlterRoleRemove:
+			ia.Alter = AlterRoleAdd
+		case AlterFieldAdd:
+			ia.Alter, ia.DataLoss = AlterFieldRemove, true
+		case AlterFieldRemove:
+			ia.Alter = AlterFieldAdd
+		case AlterFieldUpdate:
+			ia.Changes = make([]PropertyChange, len(a.Changes))
+			for i, c := range a.Changes {
+				ia.Changes[i] = PropertyChange{Key: c.Key, Previous: c.Current, Current: c.Previous}
+			}
+		}
+		list = append(list, ia)
+	}
+	for _, ia := range list {
+		if alterStage(ia.Alter) < alterStage(AlterFieldRemove) {
+			inv.Actions = append(inv.Actions, ia)
+		}
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if alterStage(list[i].Alter) >= alterStage(AlterFieldRemove) {
+			inv.Actions = append(inv.Actions, list[i])
+		}
+	}
+	sort.SliceStable(inv.Actions, func(i, j int) bool {
+		return alterStage(inv.Actions[i].Alter) < alterStage(inv.Actions[j].Alter)
+	})
+	return inv
+}
+
+// alterStage returns the position of the alter in the order of NewDelta.
+func alterStage(a Alter) int {
+	switch a {
+	case AlterNodeAdd, AlterNodeRename:
+		return 0
+	case AlterFieldRemove, AlterRoleRemove:
+		return 2
+	case AlterNodeRemove:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// movedPositions reports for each previous position, listed in current order,
+// if the field moved. The fields that did not move are the longest list of
+// fields that kept their relative order, the other fields moved.
+func movedPositions(positions []int) []bool {
+	// length[i] is the length of the longest increasing list ending at i,
+	// prev[i] is the index before i in that list or -1.
+	length := make([]int, len(positions))
+	prev := make([]int, len(positions))
+	end := -1
+	for i := range positions {
+		length[i], prev[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if positions[j] < positions[i] && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if end < 0 || length[i] > length[end] {
+			end = i
+		}
+	}
+	moved := make([]bool, len(positions))
+	for i := range moved {
+		moved[i] = true
+	}
+	for i := end; i >= 0; i = prev[i] {
+		moved[i] = false
+	}
+	return moved
+}
+
+// matchField returns the field in role other that matches the field f of role r.
+// Fields match by ID, then by name. If both roles have a FieldCount of One,
+// the single field of each role always match.
+func matchField(r *Role, f *Field, other *Role) *Field {
+	if r.roleType.FieldCount == One && other.roleType.FieldCount == One && len(r.Fields) == 1 && len(other.Fields) == 1 {
+		return &other.Fields[0]
+	}
+	if f.ID > 0 {
+		if of := other.fieldIDLookup[f.ID]; of != nil {
+			return of
+		}
+	}
+	return other.fieldNameLookup[f.name]
+}
+
+// previousNodes returns the previous node of each current node. A current
+// node is the previous node of the same name, or if there is none, the
+// previous node one of the current node alternate names refers to. An
+// alternate name refers to a previous node if it is the name or one of the
+// alternate names of the previous node, so a node renamed more then once
+// between versions is found if every prior name is kept in NameAlt.
+// The alternate names may not refer to more then one previous node, and a
+// previous node may not be the previous node of more then one current node.
+func previousNodes(current, previous *Bus) (map[*Node]*Node, error) {
+	ret := make(map[*Node]*Node, len(current.Nodes))
+	if previous == nil {
+		return ret, nil
+	}
+	// currentOf is the current node of each resolved previous node.
+	currentOf := make(map[*Node]*Node, len(current.Nodes))
+	for ni := range current.Nodes {
+		nc := &current.Nodes[ni]
+		if np := previous.Node(nc.Name); np != nil && np.Name == nc.Name {
+			ret[nc] = np
+			currentOf[np] = nc
+		}
+	}
+	var errs *Errors
+	for ni := range current.Nodes {
+		nc := &current.Nodes[ni]
+		if _, ok := ret[nc]; ok {
+			continue
+		}
+		var found *Node
+		for _, alt := range nc.NameAlt {
+			np := previous.Node(alt)
+			if np == nil || np == found {
+				continue
+			}
+			if found != nil {
+				errs = errs.add(CodeRenameAmbiguous, locNode(nc.Name, "", -1, ""), "alternate names refer to previous nodes %q and %q", found.Name, np.Name)
+				found = nil
+				break
+			}
+			found = np
+		}
+		if found == nil {
+			continue
+		}
+		if other, ok := currentOf[found]; ok {
+			errs = errs.add(CodeRenameAmbiguous, locNode(nc.Name, "", -1, ""), "previous node %q is also the previous node of %q", found.Name, other.Name)
+			continue
+		}
+		ret[nc] = found
+		currentOf[found] = nc
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return ret, nil
 }
@@ -0,0 +1,301 @@
+package bus_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestDeltaFieldUpdate(t *testing.T) {
+	table := bus.NodeType{
+		Name: "solidcoredata.org/test/table",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "length", Type: "int", Optional: true},
+					{Name: "scale", Type: "decimal", Optional: true},
+					{Name: "check", Type: "bytes", Optional: true},
+					{Name: "fk", Type: "node", Optional: true},
+				},
+			},
+		},
+	}
+	newBus := func(genre string, field bus.KV) *bus.Bus {
+		return &bus.Bus{
+			Types: []bus.NodeType{table},
+			Nodes: []bus.Node{
+				{
+					Name:    genre,
+					NameAlt: []string{"genre"},
+					Type:    table.Name,
+					Roles:   []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: bus.KV{"name": "id"}}}}},
+				},
+				{
+					Name:  "book",
+					Type:  table.Name,
+					Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: field}}}},
+				},
+			},
+		}
+	}
+	previous := newBus("genre", bus.KV{"name": "genre", "length": 10, "scale": "1.0", "check": "16x0a0b", "fk": "genre"})
+	previous.Nodes[0].NameAlt = nil
+	current := newBus("category", bus.KV{"name": "genre", "scale": "1.00", "check": "16x0a0b", "fk": "category"})
+
+	delta, err := bus.NewDelta(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []bus.PropertyChange
+	for _, a := range delta.Actions {
+		if a.Alter == bus.AlterFieldUpdate && a.NodeCurrent.Name == "book" {
+			changes = append(changes, a.Changes...)
+		}
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected a single change, got %v", changes)
+	}
+	c := changes[0]
+	if c.Key != "length" || c.Previous != int64(10) || c.Current != nil {
+		t.Fatalf("unexpected change %#v", c)
+	}
+}
+
+func TestDeltaRename(t *testing.T) {
+	node := func(name string, alt ...string) bus.Node {
+		n := updateTable(name, "int", "")
+		n.NameAlt = alt
+		return n
+	}
+	list := []struct {
+		Name     string
+		Previous []bus.Node
+		Current  []bus.Node
+		Want     []string
+		Err      bus.Code
+	}{
+		{
+			Name:     "rename",
+			Previous: []bus.Node{node("genre")},
+			Current:  []bus.Node{node("category", "genre")},
+			Want:     []string{`node-rename "genre" -> "category"`},
+		},
+		{
+			Name:     "chain-current",
+			Previous: []bus.Node{node("genre")},
+			Current:  []bus.Node{node("category", "genre", "kind")},
+			Want:     []string{`node-rename "genre" -> "category"`},
+		},
+		{
+			Name:     "chain-previous",
+			Previous: []bus.Node{node("kind", "genre")},
+			Current:  []bus.Node{node("category", "genre")},
+			Want:     []string{`node-rename "kind" -> "category"`},
+		},
+		{
+			Name:     "replace",
+			Previous: []bus.Node{node("genre")},
+			Current:  []bus.Node{node("genre"), node("category")},
+			Want:     []string{`node-add node "category"`},
+		},
+		{
+			Name:     "ambiguous-alt",
+			Previous: []bus.Node{node("genre"), node("kind")},
+			Current:  []bus.Node{node("category", "genre", "kind")},
+			Err:      bus.CodeRenameAmbiguous,
+		},
+		{
+			Name:     "ambiguous-previous",
+			Previous: []bus.Node{node("genre", "kind")},
+			Current:  []bus.Node{node("category", "genre"), node("type", "kind")},
+			Err:      bus.CodeRenameAmbiguous,
+		},
+	}
+	for _, item := range list {
+		t.Run(item.Name, func(t *testing.T) {
+			previous := &bus.Bus{Types: updateTypes, Nodes: item.Previous}
+			current := &bus.Bus{Types: updateTypes, Nodes: item.Current}
+			delta, err := bus.NewDelta(current, previous)
+			if len(item.Err) > 0 {
+				if !errors.Is(err, item.Err) {
+					t.Fatalf("expected %q, got %v", item.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for i := range delta.Actions {
+				got = append(got, delta.Actions[i].String())
+			}
+			if strings.Join(got, "\n") != strings.Join(item.Want, "\n") {
+				t.Fatalf("expected %q, got %q", item.Want, got)
+			}
+		})
+	}
+}
+
+func TestDeltaRoleReorder(t *testing.T) {
+	fields := func(names ...string) []bus.Field {
+		list := make([]bus.Field, len(names))
+		for i, name := range names {
+			list[i] = bus.Field{KV: bus.KV{"name": name, "type": "int"}}
+		}
+		return list
+	}
+	layout := bus.RoleType{Name: "layout", Properties: []bus.Property{{Name: "name", Type: "text", FieldName: true}}}
+	previousType := updateTypes[0]
+	currentType := previousType
+	currentType.Roles = append([]bus.RoleType{layout}, previousType.Roles...)
+
+	previous := &bus.Bus{
+		Types: []bus.NodeType{previousType},
+		Nodes: []bus.Node{{
+			Name:  "book",
+			Type:  previousType.Name,
+			Roles: []bus.Role{{Name: "schema", Fields: fields("id", "title", "author", "genre")}},
+		}},
+	}
+	current := &bus.Bus{
+		Types: []bus.NodeType{currentType},
+		Nodes: []bus.Node{{
+			Name: "book",
+			Type: currentType.Name,
+			Roles: []bus.Role{
+				{Name: "layout", Fields: []bus.Field{{KV: bus.KV{"name": "title"}}}},
+				{Name: "schema", Fields: fields("genre", "id", "title", "author")},
+			},
+		}},
+	}
+	delta, err := bus.NewDelta(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `role-add node "book" role "layout"
+field-reorder node "book" role "schema" field "genre" position 3 -> 0
+`
+	if got := delta.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	delta, err = bus.NewDelta(previous, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `field-reorder node "book" role "schema" field "genre" position 0 -> 3
+role-remove node "book" role "layout" (data loss)
+`
+	if got := delta.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDeltaScript(t *testing.T) {
+	previous := &bus.Bus{
+		Version: bus.Version{Sequence: 3},
+		Types:   updateTypes,
+		Nodes: []bus.Node{{
+			Name: "book",
+			Type: updateTypes[0].Name,
+			Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+				{KV: bus.KV{"name": "id", "type": "int"}},
+				{KV: bus.KV{"name": "writer", "type": "text"}},
+			}}},
+		}},
+	}
+	current := &bus.Bus{
+		Types: updateTypes,
+		Nodes: []bus.Node{{
+			Name: "book",
+			Type: updateTypes[0].Name,
+			Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+				{KV: bus.KV{"name": "id", "type": "int"}},
+				{KV: bus.KV{"name": "author", "type": "text"}},
+			}}},
+		}},
+		Scripts: []bus.Script{
+			{Name: "backfill", Extension: "crdb", From: 3, Stage: bus.ScriptBeforeRemove, Content: "update book set author = writer;"},
+			{Extension: "crdb", From: 3, Stage: bus.ScriptAfter, Content: "analyze book;"},
+			{Extension: "crdb", From: 3, Stage: bus.ScriptBefore, Content: "set sql_safe_updates = false;"},
+			{Extension: "crdb", From: 2, Stage: bus.ScriptBefore, Content: "select 2;"},
+		},
+	}
+	delta, err := bus.NewDelta(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `script "set sql_safe_updates = false;"
+field-add node "book" role "schema" field "author"
+script "update book set author = writer;"
+field-remove node "book" role "schema" field "writer" (data loss)
+script "analyze book;"
+`
+	if got := delta.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	filtered := current.FilterWith(bus.FilterOptions{Types: []string{updateTypes[0].Name}, Extension: "other"})
+	if len(filtered.Scripts) != 0 {
+		t.Fatalf("expected no scripts for other extension, got %d", len(filtered.Scripts))
+	}
+
+	invalid := &bus.Bus{
+		Types: updateTypes,
+		Scripts: []bus.Script{
+			{Name: "backfill", Extension: "crdb", Stage: bus.ScriptAfter, Content: "select 1;"},
+			{Name: "backfill", Extension: "crdb", Stage: bus.ScriptAfter, Content: "select 2;"},
+		},
+	}
+	if err := invalid.Init(); !errors.Is(err, bus.CodeScriptInvalid) {
+		t.Fatalf("expected %q, got %v", bus.CodeScriptInvalid, err)
+	}
+}
+
+func TestDeltaInvert(t *testing.T) {
+	table := updateTypes[0].Name
+	fields := func(kv ...bus.KV) []bus.Role {
+		list := make([]bus.Field, len(kv))
+		for i := range kv {
+			list[i] = bus.Field{KV: kv[i]}
+		}
+		return []bus.Role{{Name: "schema", Fields: list}}
+	}
+	previous := &bus.Bus{
+		Types: updateTypes,
+		Nodes: []bus.Node{
+			{Name: "genre", Type: table, Roles: fields(bus.KV{"name": "id", "type": "int"})},
+			{Name: "book", Type: table, Roles: fields(bus.KV{"name": "id", "type": "int"}, bus.KV{"name": "title", "type": "text"})},
+		},
+	}
+	current := &bus.Bus{
+		Types: updateTypes,
+		Nodes: []bus.Node{
+			{Name: "category", NameAlt: []string{"genre"}, Type: table, Roles: fields(bus.KV{"name": "id", "type": "bigint"})},
+			{Name: "book", Type: table, Roles: fields(bus.KV{"name": "id", "type": "int"}, bus.KV{"name": "author", "type": "text"})},
+			{Name: "author", Type: table, Roles: fields(bus.KV{"name": "id", "type": "int"})},
+		},
+		Scripts: []bus.Script{{Extension: "crdb", Stage: bus.ScriptBeforeRemove, Content: "select 1;"}},
+	}
+	delta, err := bus.NewDelta(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := delta.Invert()
+	if inv.Current != previous || inv.Previous != current {
+		t.Fatal("expected current and previous to be swapped")
+	}
+	want := `node-rename "category" -> "genre"
+field-update node "genre" role "schema" field "id": type "bigint" -> "int"
+field-add node "book" role "schema" field "title"
+field-remove node "book" role "schema" field "author" (data loss)
+node-remove node "author" (data loss)
+`
+	if got := inv.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s\nforward:\n%s", got, want, delta)
+	}
+}
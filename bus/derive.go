@@ -0,0 +1,494 @@
+package bus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A default expression derives the value of a property from other values,
+// see Property.DefaultExpr. The expression grammar is:
+//
+//	expr      = sum { "??" sum }            First operand that is not null.
+//	sum       = operand { "+" operand }     Add numbers or join text.
+//	operand   = literal | reference | "(" expr ")"
+//	literal   = text in double quotes, a number, true, false, or null
+//	reference = "$.field." property         Property of the same field.
+//	          | "$.bind." property          Property of the bound field, see below.
+//	          | "$.node." role "." property Property of a role with one field in the same node.
+//
+// The bound field is found in the same way received values are: through the
+// field Alias, in the role of the same name on the bound node. A bind
+// reference is null if the field has no alias or the bound node is external.
+// If any operand of "+" is null, the sum is null.
+//
+// Default expressions are evaluated after received values are set, in the
+// order the expressions of the node type depend on each other. The values
+// of bound nodes are evaluated before the nodes bound to them.
+
+const (
+	exprScopeField = "field"
+	exprScopeBind  = "bind"
+	exprScopeNode  = "node"
+)
+
+// expr is a parsed default expression.
+type expr interface {
+	eval(env *exprEnv) (interface{}, error)
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+type exprRef struct {
+	scope    string
+	role     string // Role name of a node reference.
+	property string
+}
+
+type exprBinary struct {
+	op          string
+	left, right expr
+}
+
+// exprEnv is the field an expression is evaluated for.
+type exprEnv struct {
+	n  *Node
+	r  *Role
+	fi int
+}
+
+func (e *exprLiteral) eval(env *exprEnv) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *exprRef) eval(env *exprEnv) (interface{}, error) {
+	switch e.scope {
+	default:
+		return nil, fmt.Errorf("unknown reference scope %q", e.scope)
+	case exprScopeField:
+		return env.r.Fields[env.fi].values[e.property], nil
+	case exprScopeNode:
+		r := env.n.roleLookup[e.role]
+		if r == nil || len(r.Fields) == 0 {
+			return nil, nil
+		}
+		return r.Fields[0].values[e.property], nil
+	case exprScopeBind:
+		_, bf, errs := boundField(env.n, env.r, env.fi)
+		if errs != nil {
+			return nil, errs
+		}
+		if bf == nil {
+			return nil, nil
+		}
+		v, ok := bf.values[e.property]
+		if !ok {
+			return nil, fmt.Errorf("bound field has no property %q", e.property)
+		}
+		return v, nil
+	}
+}
+
+func (e *exprBinary) eval(env *exprEnv) (interface{}, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "??" && left != nil {
+		return left, nil
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "??" {
+		return right, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch l := left.(type) {
+	case string:
+		if r, ok := right.(string); ok {
+			return l + r, nil
+		}
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			return l + r, nil
+		case float64:
+			return float64(l) + r, nil
+		}
+	case float64:
+		switch r := right.(type) {
+		case int64:
+			return l + float64(r), nil
+		case float64:
+			return l + r, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to add %[1]T (%[1]v) and %[2]T (%[2]v)", left, right)
+}
+
+// exprRefs calls fn for each reference in the expression.
+func exprRefs(e expr, fn func(ref *exprRef)) {
+	switch e := e.(type) {
+	case *exprRef:
+		fn(e)
+	case *exprBinary:
+		exprRefs(e.left, fn)
+		exprRefs(e.right, fn)
+	}
+}
+
+// exprParser parses a default expression.
+type exprParser struct {
+	text string
+	pos  int
+}
+
+func parseExpr(text string) (expr, error) {
+	p := &exprParser{text: text}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.pos < len(p.text) {
+		return nil, p.errorf("unexpected %q", p.text[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *exprParser) errorf(f string, v ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", p.pos, fmt.Sprintf(f, v...))
+}
+
+func (p *exprParser) space() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// next consumes the token if it is next.
+func (p *exprParser) next(token string) bool {
+	p.space()
+	if strings.HasPrefix(p.text[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseExpr() (expr, error) {
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	for p.next("??") {
+		right, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		e = &exprBinary{op: "??", left: e, right: right}
+	}
+	return e, nil
+}
+
+func (p *exprParser) parseSum() (expr, error) {
+	e, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.next("+") {
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		e = &exprBinary{op: "+", left: e, right: right}
+	}
+	return e, nil
+}
+
+func (p *exprParser) parseOperand() (expr, error) {
+	p.space()
+	if p.pos >= len(p.text) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	switch c := p.text[p.pos]; {
+	case c == '(':
+		p.pos++
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.next(")") {
+			return nil, p.errorf("missing %q", ")")
+		}
+		return e, nil
+	case c == '"':
+		end := p.pos + 1
+		for ; end < len(p.text); end++ {
+			if p.text[end] == '\\' {
+				end++
+				continue
+			}
+			if p.text[end] == '"' {
+				break
+			}
+		}
+		if end >= len(p.text) {
+			return nil, p.errorf("unterminated text")
+		}
+		s, err := strconv.Unquote(p.text[p.pos : end+1])
+		if err != nil {
+			return nil, p.errorf("invalid text: %v", err)
+		}
+		p.pos = end + 1
+		return &exprLiteral{value: s}, nil
+	case c == '$':
+		return p.parseRef()
+	case c == '-' || (c >= '0' && c <= '9'):
+		word := p.word()
+		if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+			return &exprLiteral{value: i}, nil
+		}
+		f, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", word)
+		}
+		return &exprLiteral{value: f}, nil
+	default:
+		start := p.pos
+		switch word := p.word(); word {
+		default:
+			p.pos = start
+			if len(word) == 0 {
+				word = string(c)
+			}
+			return nil, p.errorf("unexpected %q", word)
+		case "true":
+			return &exprLiteral{value: true}, nil
+		case "false":
+			return &exprLiteral{value: false}, nil
+		case "null":
+			return &exprLiteral{value: nil}, nil
+		}
+	}
+}
+
+// word consumes a name or number.
+func (p *exprParser) word() string {
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := rune(p.text[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '-' && c != '.' {
+			break
+		}
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+func (p *exprParser) parseRef() (expr, error) {
+	start := p.pos
+	if !p.next("$.") {
+		return nil, p.errorf("expected %q", "$.")
+	}
+	parts := strings.Split(p.word(), ".")
+	for _, part := range parts {
+		if len(part) == 0 {
+			p.pos = start
+			return nil, p.errorf("invalid reference")
+		}
+	}
+	ref := &exprRef{scope: parts[0]}
+	switch ref.scope {
+	default:
+		p.pos = start
+		return nil, p.errorf("unknown reference scope %q, must be one of %q, %q, or %q", ref.scope, exprScopeField, exprScopeBind, exprScopeNode)
+	case exprScopeField, exprScopeBind:
+		if len(parts) != 2 {
+			p.pos = start
+			return nil, p.errorf("reference must be $.%s.property", ref.scope)
+		}
+		ref.property = parts[1]
+	case exprScopeNode:
+		if len(parts) != 3 {
+			p.pos = start
+			return nil, p.errorf("reference must be $.%s.role.property", ref.scope)
+		}
+		ref.role, ref.property = parts[1], parts[2]
+	}
+	return ref, nil
+}
+
+// derivation is a property with a default expression in a role of a node type.
+type derivation struct {
+	role string
+	pr   *Property
+}
+
+// initDerive parses the default expressions of the node type and orders them
+// so each expression is evaluated after the expressions it refers to.
+func (nt *NodeType) initDerive() *Errors {
+	var errs *Errors
+	nt.derive = nil
+	var list []derivation
+	for ri := range nt.roles {
+		rt := &nt.roles[ri]
+		if nt.roleLookup[rt.Name] != rt {
+			continue
+		}
+		for pi := range rt.Properties {
+			pr := &rt.Properties[pi]
+			pr.expr = nil
+			if len(pr.DefaultExpr) == 0 || rt.propNameLookup[pr.Name] != pr {
+				continue
+			}
+			loc := locType(nt.Name, rt.Name, pr.Name)
+			if pr.Default != nil {
+				errs = errs.add(CodeExprInvalid, loc, "may not have both a Default and a DefaultExpr")
+				continue
+			}
+			if pr.Type == "node" {
+				errs = errs.add(CodeExprInvalid, loc, "DefaultExpr not allowed on type %q", pr.Type)
+				continue
+			}
+			e, err := parseExpr(pr.DefaultExpr)
+			if err != nil {
+				errs = errs.add(CodeExprInvalid, loc, "expression %q: %v", pr.DefaultExpr, err)
+				continue
+			}
+			valid := true
+			exprRefs(e, func(ref *exprRef) {
+				switch ref.scope {
+				case exprScopeField:
+					if rt.propNameLookup[ref.property] == nil {
+						errs = errs.add(CodeExprInvalid, loc, "expression %q: unknown property %q", pr.DefaultExpr, ref.property)
+						valid = false
+					}
+				case exprScopeNode:
+					ort := nt.roleLookup[ref.role]
+					switch {
+					case ort == nil:
+						errs = errs.add(CodeExprInvalid, loc, "expression %q: unknown role %q", pr.DefaultExpr, ref.role)
+						valid = false
+					case ort.FieldCount != One:
+						errs = errs.add(CodeExprInvalid, loc, "expression %q: role %q must have a FieldCount of One", pr.DefaultExpr, ref.role)
+						valid = false
+					case ort.propNameLookup[ref.property] == nil:
+						errs = errs.add(CodeExprInvalid, loc, "expression %q: unknown property %q in role %q", pr.DefaultExpr, ref.property, ref.role)
+						valid = false
+					}
+				}
+			})
+			if !valid {
+				continue
+			}
+			pr.expr = e
+			list = append(list, derivation{role: rt.Name, pr: pr})
+		}
+	}
+	if errs != nil || len(list) == 0 {
+		return errs
+	}
+
+	// Order the derivations with a depth first search, dependencies first.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*Property]int, len(list))
+	var visit func(d derivation) bool
+	visit = func(d derivation) bool {
+		switch state[d.pr] {
+		case visiting:
+			errs = errs.add(CodeExprCircular, locType(nt.Name, d.role, d.pr.Name), "default expression %q refers to itself", d.pr.DefaultExpr)
+			return false
+		case visited:
+			return true
+		}
+		state[d.pr] = visiting
+		ok := true
+		exprRefs(d.pr.expr, func(ref *exprRef) {
+			if !ok {
+				return
+			}
+			var dep derivation
+			switch ref.scope {
+			default:
+				return
+			case exprScopeField:
+				dep = derivation{role: d.role, pr: nt.roleLookup[d.role].propNameLookup[ref.property]}
+			case exprScopeNode:
+				dep = derivation{role: ref.role, pr: nt.roleLookup[ref.role].propNameLookup[ref.property]}
+			}
+			if dep.pr.expr != nil {
+				ok = visit(dep)
+			}
+		})
+		state[d.pr] = visited
+		if ok {
+			nt.derive = append(nt.derive, d)
+		}
+		return ok
+	}
+	for _, d := range list {
+		if state[d.pr] == unvisited && !visit(d) {
+			nt.derive = nil
+			return errs
+		}
+	}
+	return nil
+}
+
+// deriveNode sets the value of each unset field property from the property
+// default expression. The bound nodes must already be derived.
+func deriveNode(n *Node) *Errors {
+	nt := n.nodeType
+	if nt == nil || len(nt.derive) == 0 {
+		return nil
+	}
+	var errs *Errors
+	for _, d := range nt.derive {
+		r := n.roleLookup[d.role]
+		if r == nil {
+			continue
+		}
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			if _, set := f.KV[d.pr.Name]; set || f.values[d.pr.Name] != nil {
+				continue
+			}
+			v, err := d.pr.expr.eval(&exprEnv{n: n, r: r, fi: fi})
+			if list, ok := err.(*Errors); ok {
+				errs = errs.Append(list)
+				continue
+			}
+			loc := locNode(n.Name, r.Name, fi, d.pr.Name)
+			if err != nil {
+				errs = errs.add(CodeExprValue, loc, "default expression %q: %v", d.pr.DefaultExpr, err)
+				continue
+			}
+			if v == nil {
+				continue
+			}
+			value, err := validValue(d.pr, v, nil)
+			if err != nil {
+				errs = errs.add(CodeExprValue, loc, "default expression %q: invalid value for type %q: %v", d.pr.DefaultExpr, d.pr.Type, err)
+				continue
+			}
+			if err = d.pr.checkConstraint(value); err != nil {
+				errs = errs.add(CodeExprValue, loc, "default expression %q: %v", d.pr.DefaultExpr, err)
+				continue
+			}
+			f.values[d.pr.Name] = value
+		}
+	}
+	return errs
+}
@@ -0,0 +1,194 @@
+package bus_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestDefaultExpr(t *testing.T) {
+	table := bus.NodeType{
+		Name: "solidcoredata.org/test/table",
+		Roles: []bus.RoleType{
+			{
+				Name:       "prop",
+				FieldCount: bus.One,
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "title", Type: "text", DefaultExpr: `"Table " + $.field.name`},
+				},
+			},
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true, Send: true},
+					{Name: "label", Type: "text", DefaultExpr: `$.node.prop.title + ": " + $.field.display`},
+					{Name: "display", Type: "text", Send: true, DefaultExpr: `$.field.name`},
+					{Name: "size", Type: "int", Optional: true},
+					{Name: "width", Type: "int", Optional: true, DefaultExpr: `($.field.size + 2) ?? 10`},
+				},
+			},
+		},
+	}
+	ui := bus.NodeType{
+		Name: "solidcoredata.org/test/ui",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "display", Type: "text", DefaultExpr: `$.bind.display ?? $.field.name`},
+				},
+			},
+		},
+	}
+	b := &bus.Bus{
+		Types: []bus.NodeType{table, ui},
+		Nodes: []bus.Node{
+			{
+				Name:  "book_ui",
+				Type:  ui.Name,
+				Binds: []bus.Bind{{Alias: "b", Name: "book"}},
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+					{Alias: "b", KV: bus.KV{"name": "id"}},
+					{Alias: "b", KV: bus.KV{"name": "title"}},
+					{KV: bus.KV{"name": "local"}},
+				}}},
+			},
+			{
+				Name: "book",
+				Type: table.Name,
+				Roles: []bus.Role{
+					{Name: "prop", Fields: []bus.Field{{KV: bus.KV{"name": "book"}}}},
+					{Name: "schema", Fields: []bus.Field{
+						{KV: bus.KV{"name": "id", "size": 4}},
+						{KV: bus.KV{"name": "title", "display": "Book Title"}},
+					}},
+				},
+			},
+		},
+	}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(node, role string, fi int, key string, want interface{}) {
+		t.Helper()
+		got := b.Node(node).Role(role).Fields[fi].Value(key)
+		if got != want {
+			t.Errorf("node %q role %q field %d %q: expected %v, got %v", node, role, fi, key, want, got)
+		}
+	}
+	check("book", "prop", 0, "title", "Table book")
+	check("book", "schema", 0, "display", "id")
+	check("book", "schema", 0, "label", "Table book: id")
+	check("book", "schema", 0, "width", int64(6))
+	check("book", "schema", 1, "display", "Book Title")
+	check("book", "schema", 1, "label", "Table book: Book Title")
+	check("book", "schema", 1, "width", int64(10))
+	check("book_ui", "schema", 0, "display", "id")
+	check("book_ui", "schema", 1, "display", "Book Title")
+	check("book_ui", "schema", 2, "display", "local")
+
+	list := []struct {
+		Name string
+		Prop []bus.Property
+		Code bus.Code
+	}{
+		{
+			Name: "parse",
+			Prop: []bus.Property{{Name: "a", Type: "text", DefaultExpr: `$.field.b +`}},
+			Code: bus.CodeExprInvalid,
+		},
+		{
+			Name: "unknown-property",
+			Prop: []bus.Property{{Name: "a", Type: "text", DefaultExpr: `$.field.b`}},
+			Code: bus.CodeExprInvalid,
+		},
+		{
+			Name: "unknown-scope",
+			Prop: []bus.Property{{Name: "a", Type: "text", DefaultExpr: `$.other.b`}},
+			Code: bus.CodeExprInvalid,
+		},
+		{
+			Name: "default",
+			Prop: []bus.Property{{Name: "a", Type: "text", Default: "a", DefaultExpr: `"b"`}},
+			Code: bus.CodeExprInvalid,
+		},
+		{
+			Name: "circular",
+			Prop: []bus.Property{
+				{Name: "a", Type: "text", DefaultExpr: `$.field.c`},
+				{Name: "b", Type: "text", DefaultExpr: `$.field.a`},
+				{Name: "c", Type: "text", DefaultExpr: `$.field.b`},
+			},
+			Code: bus.CodeExprCircular,
+		},
+		{
+			Name: "value-type",
+			Prop: []bus.Property{{Name: "a", Type: "int", DefaultExpr: `"text"`}},
+			Code: bus.CodeExprValue,
+		},
+		{
+			Name: "add-type",
+			Prop: []bus.Property{{Name: "a", Type: "text", DefaultExpr: `"text" + 1`}},
+			Code: bus.CodeExprValue,
+		},
+	}
+	for _, item := range list {
+		t.Run(item.Name, func(t *testing.T) {
+			props := append([]bus.Property{{Name: "name", Type: "text", FieldName: true}}, item.Prop...)
+			b := &bus.Bus{
+				Types: []bus.NodeType{{
+					Name:  "solidcoredata.org/test/expr",
+					Roles: []bus.RoleType{{Name: "schema", Properties: props}},
+				}},
+				Nodes: []bus.Node{{
+					Name:  "node",
+					Type:  "solidcoredata.org/test/expr",
+					Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: bus.KV{"name": "id"}}}}},
+				}},
+			}
+			err := b.Init()
+			if !errors.Is(err, item.Code) {
+				t.Fatalf("expected %q, got %v", item.Code, err)
+			}
+			if errors.Is(err, bus.CodeRequired) {
+				t.Fatalf("unexpected %q for a value with an error: %v", bus.CodeRequired, err)
+			}
+		})
+	}
+}
+
+func TestDefaultExprCopy(t *testing.T) {
+	b := &bus.Bus{
+		Types: []bus.NodeType{{
+			Name: "solidcoredata.org/test/expr",
+			Roles: []bus.RoleType{{Name: "schema", Properties: []bus.Property{
+				{Name: "name", Type: "text", FieldName: true},
+				{Name: "price", Type: "decimal"},
+				{Name: "price_copy", Type: "decimal", DefaultExpr: `$.field.price`},
+				{Name: "data", Type: "bytes"},
+				{Name: "data_copy", Type: "bytes", DefaultExpr: `$.field.data`},
+			}}},
+		}},
+		Nodes: []bus.Node{{
+			Name: "node",
+			Type: "solidcoredata.org/test/expr",
+			Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+				{KV: bus.KV{"name": "id", "price": "1.5", "data": "16x0a0b"}},
+			}}},
+		}},
+	}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	f := b.Node("node").Role("schema").Fields[0]
+	if got, want := fmt.Sprint(f.Value("price_copy")), "1.5"; got != want {
+		t.Errorf("price_copy: expected %s, got %s", want, got)
+	}
+	if got, want := fmt.Sprint(f.Value("data_copy")), "[10 11]"; got != want {
+		t.Errorf("data_copy: expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,351 @@
+package bus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DiffFormat is the output format of DeltaBus.Write.
+type DiffFormat string
+
+const (
+	DiffText    DiffFormat = "text"    // One line for each action.
+	DiffJSON    DiffFormat = "json"    // JSON array of actions.
+	DiffUnified DiffFormat = "unified" // Unified diff of the node definitions of each changed node.
+)
+
+// deltaActionJSON is the JSON encoding of a DeltaAction. A field is the
+// field name, or "#" and the field index if the field has no name.
+type deltaActionJSON struct {
+	Alter         Alter
+	Node          string               `json:",omitempty"`
+	NodePrevious  string               `json:",omitempty"`
+	Role          string               `json:",omitempty"`
+	Field         string               `json:",omitempty"`
+	FieldPrevious string               `json:",omitempty"`
+	Script        string               `json:",omitempty"`
+	Changes       []propertyChangeJSON `json:",omitempty"`
+	DataLoss      bool                 `json:",omitempty"`
+
+	// Positions of an AlterFieldReorder.
+	Position         *int `json:",omitempty"`
+	PositionPrevious *int `json:",omitempty"`
+}
+
+type propertyChangeJSON struct {
+	Key      string
+	Previous interface{}
+	Current  interface{}
+}
+
+// String returns the delta in the DiffText format.
+func (db *DeltaBus) String() string {
+	buf := &bytes.Buffer{}
+	if err := db.Write(buf, DiffText); err != nil {
+		return "bus: " + err.Error()
+	}
+	return buf.String()
+}
+
+// Write the actions of the delta to w in the format.
+func (db *DeltaBus) Write(w io.Writer, format DiffFormat) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	default:
+		return fmt.Errorf("bus: unknown diff format %q", format)
+	case DiffText, "":
+		for i := range db.Actions {
+			bw.WriteString(db.Actions[i].String())
+			bw.WriteRune('\n')
+		}
+	case DiffJSON:
+		err = db.writeJSON(bw)
+	case DiffUnified:
+		db.writeUnified(bw)
+	}
+	// Output written before an error is still flushed.
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// writeJSON writes the actions as a JSON array.
+func (db *DeltaBus) writeJSON(w io.Writer) error {
+	list := make([]deltaActionJSON, len(db.Actions))
+	for i := range db.Actions {
+		a, err := db.Actions[i].encode()
+		if err != nil {
+			return err
+		}
+		list[i] = a
+	}
+	coder := json.NewEncoder(w)
+	coder.SetEscapeHTML(false)
+	coder.SetIndent("", "\t")
+	return coder.Encode(list)
+}
+
+// String returns a single line description of the action.
+func (a *DeltaAction) String() string {
+	b := &strings.Builder{}
+	b.WriteString(a.Alter.String())
+	switch a.Alter {
+	case AlterScript:
+		b.WriteString(" ")
+		b.WriteString(strconv.Quote(a.Script))
+		return b.String()
+	case AlterNodeRename:
+		fmt.Fprintf(b, " %q -> %q", a.NodePrevious.Name, a.NodeCurrent.Name)
+		return b.String()
+	}
+	n := a.NodeCurrent
+	if n == nil {
+		n = a.NodePrevious
+	}
+	if n != nil {
+		fmt.Fprintf(b, " node %q", n.Name)
+	}
+	f, fn := a.FieldCurrent, a.NodeCurrent
+	if f == nil {
+		f, fn = a.FieldPrevious, a.NodePrevious
+	}
+	if f == nil {
+		if len(a.Role) > 0 {
+			fmt.Fprintf(b, " role %q", a.Role)
+		}
+	} else {
+		role, fi := fn.fieldRole(f)
+		fmt.Fprintf(b, " role %q field %s", role, fieldLabel(f, fi))
+	}
+	if a.Alter == AlterFieldRename && a.FieldPrevious != nil {
+		_, pi := a.NodePrevious.fieldRole(a.FieldPrevious)
+		fmt.Fprintf(b, " from %s", fieldLabel(a.FieldPrevious, pi))
+	}
+	if a.Alter == AlterFieldReorder {
+		fmt.Fprintf(b, " position %d -> %d", a.PositionPrevious, a.Position)
+	}
+	for i, c := range a.Changes {
+		if i == 0 {
+			b.WriteString(":")
+		} else {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(b, " %s %s -> %s", c.Key, formatValue(c.Previous), formatValue(c.Current))
+	}
+	if a.DataLoss {
+		b.WriteString(" (data loss)")
+	}
+	return b.String()
+}
+
+func (a *DeltaAction) encode() (deltaActionJSON, error) {
+	ret := deltaActionJSON{
+		Alter:    a.Alter,
+		Role:     a.Role,
+		Script:   a.Script,
+		DataLoss: a.DataLoss,
+	}
+	if a.Alter == AlterFieldReorder {
+		position, previous := a.Position, a.PositionPrevious
+		ret.Position, ret.PositionPrevious = &position, &previous
+	}
+	if a.NodeCurrent != nil {
+		ret.Node = a.NodeCurrent.Name
+	}
+	if a.NodePrevious != nil {
+		ret.NodePrevious = a.NodePrevious.Name
+	}
+	if a.FieldCurrent != nil {
+		_, fi := a.NodeCurrent.fieldRole(a.FieldCurrent)
+		ret.Field = fieldRef(a.FieldCurrent, fi)
+	}
+	if a.FieldPrevious != nil {
+		_, fi := a.NodePrevious.fieldRole(a.FieldPrevious)
+		ret.FieldPrevious = fieldRef(a.FieldPrevious, fi)
+	}
+	for _, c := range a.Changes {
+		prev, err := canonicalValue(c.Previous)
+		if err != nil {
+			return ret, fmt.Errorf("bus: property %q previous value: %w", c.Key, err)
+		}
+		cur, err := canonicalValue(c.Current)
+		if err != nil {
+			return ret, fmt.Errorf("bus: property %q current value: %w", c.Key, err)
+		}
+		ret.Changes = append(ret.Changes, propertyChangeJSON{Key: c.Key, Previous: prev, Current: cur})
+	}
+	return ret, nil
+}
+
+// fieldRole returns the role name and the index of the field in the node.
+func (n *Node) fieldRole(f *Field) (string, int) {
+	if n == nil {
+		return "", -1
+	}
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		for fi := range r.Fields {
+			if &r.Fields[fi] == f {
+				return r.Name, fi
+			}
+		}
+	}
+	return "", -1
+}
+
+// fieldRef returns the field name, or the field index if the field has no name.
+func fieldRef(f *Field, fi int) string {
+	if len(f.name) > 0 {
+		return f.name
+	}
+	return "#" + strconv.Itoa(fi)
+}
+
+// fieldLabel returns the quoted field name, or the field index if the field has no name.
+func fieldLabel(f *Field, fi int) string {
+	if len(f.name) > 0 {
+		return strconv.Quote(f.name)
+	}
+	return fieldRef(f, fi)
+}
+
+// formatValue returns the canonical JSON text of a normalized value.
+func formatValue(v interface{}) string {
+	cv, err := canonicalValue(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	buf := &bytes.Buffer{}
+	coder := json.NewEncoder(buf)
+	coder.SetEscapeHTML(false)
+	if err = coder.Encode(cv); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// writeUnified writes a unified diff of the definition of each node changed
+// by an action, in the order the nodes are first changed.
+func (db *DeltaBus) writeUnified(w *bufio.Writer) {
+	type pair struct {
+		current, previous *Node
+	}
+	var list []pair
+	seen := make(map[pair]bool)
+	for _, a := range db.Actions {
+		p := pair{current: a.NodeCurrent, previous: a.NodePrevious}
+		if (p.current == nil && p.previous == nil) || seen[p] {
+			continue
+		}
+		seen[p] = true
+		list = append(list, p)
+	}
+	for _, p := range list {
+		from, to := "/dev/null", "/dev/null"
+		if p.previous != nil {
+			from = "a/" + p.previous.Name
+		}
+		if p.current != nil {
+			to = "b/" + p.current.Name
+		}
+		prev, cur := p.previous.lines(), p.current.lines()
+		fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to)
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(len(prev)), hunkRange(len(cur)))
+		for _, line := range diffLines(prev, cur) {
+			w.WriteString(line)
+			w.WriteRune('\n')
+		}
+	}
+}
+
+// hunkRange returns the unified diff range of a hunk of all count lines.
+func hunkRange(count int) string {
+	if count == 0 {
+		return "0,0"
+	}
+	return "1," + strconv.Itoa(count)
+}
+
+// lines returns the definition of the node as text lines: the node name and
+// type, the binds, and the normalized values of each field.
+func (n *Node) lines() []string {
+	if n == nil {
+		return nil
+	}
+	ret := []string{fmt.Sprintf("node %q type %q", n.Name, n.Type)}
+	for _, bd := range n.Binds {
+		ret = append(ret, fmt.Sprintf("\tbind %s %q", bd.Alias, bd.Name))
+	}
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		ret = append(ret, fmt.Sprintf("\trole %s", r.Name))
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			line := &strings.Builder{}
+			fmt.Fprintf(line, "\t\tfield %s", fieldLabel(f, fi))
+			if len(f.Alias) > 0 {
+				fmt.Fprintf(line, " alias %s", f.Alias)
+			}
+			for _, key := range sortedKeys(f.values) {
+				if f.values[key] == nil {
+					continue
+				}
+				fmt.Fprintf(line, " %s=%s", key, formatValue(f.values[key]))
+			}
+			ret = append(ret, line.String())
+		}
+	}
+	return ret
+}
+
+// diffLines returns the lines of a unified diff from a to b, each line prefixed
+// with "-" if only in a, "+" if only in b, or " " if in both.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	ret := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, "-"+a[i])
+			i++
+		default:
+			ret = append(ret, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ret = append(ret, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, "+"+b[j])
+	}
+	return ret
+}
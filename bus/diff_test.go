@@ -0,0 +1,119 @@
+package bus_test
+
+import (
+	"bytes"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestDeltaWrite(t *testing.T) {
+	previous := &bus.Bus{
+		Types: updateTypes,
+		Nodes: []bus.Node{
+			updateTable("book", "int", ""),
+			updateTable("old", "int", ""),
+		},
+	}
+	book := updateTable("book", "bigint", "")
+	book.Roles[0].Fields = append(book.Roles[0].Fields, bus.Field{KV: bus.KV{"name": "title", "type": "text"}})
+	current := &bus.Bus{
+		Types: updateTypes,
+		Nodes: []bus.Node{
+			book,
+			updateTable("author", "int", ""),
+		},
+	}
+	delta, err := bus.NewDelta(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []struct {
+		Format bus.DiffFormat
+		Want   string
+	}{
+		{
+			Format: bus.DiffText,
+			Want: `node-add node "author"
+field-update node "book" role "schema" field "id": type "int" -> "bigint"
+field-add node "book" role "schema" field "title"
+node-remove node "old" (data loss)
+`,
+		},
+		{
+			Format: bus.DiffJSON,
+			Want: `[
+	{
+		"Alter": "node-add",
+		"Node": "author"
+	},
+	{
+		"Alter": "field-update",
+		"Node": "book",
+		"NodePrevious": "book",
+		"Role": "schema",
+		"Field": "id",
+		"FieldPrevious": "id",
+		"Changes": [
+			{
+				"Key": "type",
+				"Previous": "int",
+				"Current": "bigint"
+			}
+		]
+	},
+	{
+		"Alter": "field-add",
+		"Node": "book",
+		"NodePrevious": "book",
+		"Role": "schema",
+		"Field": "title"
+	},
+	{
+		"Alter": "node-remove",
+		"NodePrevious": "old",
+		"DataLoss": true
+	}
+]
+`,
+		},
+		{
+			Format: bus.DiffUnified,
+			Want: `--- /dev/null
++++ b/author
+@@ -0,0 +1,3 @@
++node "author" type "solidcoredata.org/test/table"
++	role schema
++		field "id" name="id" type="int"
+--- a/book
++++ b/book
+@@ -1,3 +1,4 @@
+ node "book" type "solidcoredata.org/test/table"
+ 	role schema
+-		field "id" name="id" type="int"
++		field "id" name="id" type="bigint"
++		field "title" name="title" type="text"
+--- a/old
++++ /dev/null
+@@ -1,3 +0,0 @@
+-node "old" type "solidcoredata.org/test/table"
+-	role schema
+-		field "id" name="id" type="int"
+`,
+		},
+	}
+	for _, item := range list {
+		t.Run(string(item.Format), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := delta.Write(buf, item.Format); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != item.Want {
+				t.Fatalf("got:\n%s\nwant:\n%s", got, item.Want)
+			}
+		})
+	}
+	if delta.String() != list[0].Want {
+		t.Fatalf("String does not match the text format:\n%s", delta.String())
+	}
+}
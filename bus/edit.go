@@ -0,0 +1,262 @@
+package bus
+
+import (
+	"fmt"
+)
+
+// Editor changes the nodes of a bus. An Editor is only valid within
+// the function passed to Bus.Edit.
+//
+// Changes are made to the node definitions: the node names, binds, and
+// field KV values. The bus lookups and node order are updated after all
+// changes are made.
+type Editor struct {
+	b     *Bus
+	index map[string]int // Node index by node name.
+
+	// types is the node type lookup prior to the edit.
+	types map[string]*NodeType
+}
+
+// Edit the bus nodes. After fn returns, the bus is initialized again with the
+// same options. If fn returns an error or the changed bus is not valid,
+// the bus is restored to the state prior to the edit and the error is returned.
+// Pointers to nodes, roles, and fields obtained prior to the edit must not be
+// used after the edit.
+func (b *Bus) Edit(fn func(e *Editor) error) error {
+	if err := b.InitWith(b.opts); err != nil {
+		return err
+	}
+	backup := make([]Node, len(b.Nodes))
+	for i, n := range b.Nodes {
+		backup[i] = n.copy(nil)
+	}
+	e := &Editor{
+		b:     b,
+		index: make(map[string]int, len(b.Nodes)),
+		types: b.typeLookup,
+	}
+	for i := range b.Nodes {
+		e.index[b.Nodes[i].Name] = i
+	}
+	err := fn(e)
+	if err == nil {
+		b.setup = false
+		err = b.InitWith(b.opts)
+		if err == nil {
+			return nil
+		}
+	}
+	b.Nodes = backup
+	b.setup = false
+	if rerr := b.InitWith(b.opts); rerr != nil {
+		return fmt.Errorf("bus: unable to restore bus after edit error %v: %w", err, rerr)
+	}
+	return err
+}
+
+func (e *Editor) node(name string) (*Node, error) {
+	i, ok := e.index[name]
+	if !ok {
+		return nil, fmt.Errorf("bus: edit node %q not found", name)
+	}
+	return &e.b.Nodes[i], nil
+}
+
+func (e *Editor) field(node, role string, field int) (*Field, error) {
+	n, err := e.node(node)
+	if err != nil {
+		return nil, err
+	}
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		if r.Name != role {
+			continue
+		}
+		if field < 0 || field >= len(r.Fields) {
+			return nil, fmt.Errorf("bus: edit node %q role %q field index %d out of range", node, role, field)
+		}
+		return &r.Fields[field], nil
+	}
+	return nil, fmt.Errorf("bus: edit node %q role %q not found", node, role)
+}
+
+// AddNode adds a new node to the bus.
+func (e *Editor) AddNode(n Node) error {
+	if len(n.Name) == 0 {
+		return fmt.Errorf("bus: edit add node missing name")
+	}
+	if _, ok := e.index[n.Name]; ok {
+		return fmt.Errorf("bus: edit add node %q already defined", n.Name)
+	}
+	e.b.Nodes = append(e.b.Nodes, n.copy(nil))
+	e.index[n.Name] = len(e.b.Nodes) - 1
+	return nil
+}
+
+// RemoveNode removes the named node from the bus.
+// Any references to the node must also be removed.
+func (e *Editor) RemoveNode(name string) error {
+	i, ok := e.index[name]
+	if !ok {
+		return fmt.Errorf("bus: edit remove node %q not found", name)
+	}
+	e.b.Nodes = append(e.b.Nodes[:i], e.b.Nodes[i+1:]...)
+	delete(e.index, name)
+	for j := i; j < len(e.b.Nodes); j++ {
+		e.index[e.b.Nodes[j].Name] = j
+	}
+	return nil
+}
+
+// RenameNode renames a node and updates all binds and node values that reference it.
+// The previous name is added to the node NameAlt so the rename may be tracked
+// between versions.
+func (e *Editor) RenameNode(from, to string) error {
+	i, ok := e.index[from]
+	if !ok {
+		return fmt.Errorf("bus: edit rename node %q not found", from)
+	}
+	n := &e.b.Nodes[i]
+	if len(to) == 0 {
+		return fmt.Errorf("bus: edit rename node %q missing new name", from)
+	}
+	if _, ok := e.index[to]; ok {
+		return fmt.Errorf("bus: edit rename node %q to %q already defined", from, to)
+	}
+	n.Name = to
+	alt := make([]string, 0, len(n.NameAlt)+1)
+	for _, a := range n.NameAlt {
+		if a != to {
+			alt = append(alt, a)
+		}
+	}
+	n.NameAlt = append(alt, from)
+	delete(e.index, from)
+	e.index[to] = i
+
+	for ni := range e.b.Nodes {
+		n := &e.b.Nodes[ni]
+		for bi := range n.Binds {
+			if n.Binds[bi].Name == from {
+				n.Binds[bi].Name = to
+			}
+		}
+		nt := e.types[n.Type]
+		if nt == nil {
+			continue
+		}
+		for ri := range n.Roles {
+			r := &n.Roles[ri]
+			rt := nt.roleLookup[r.Name]
+			if rt == nil {
+				continue
+			}
+			for fi := range r.Fields {
+				f := &r.Fields[fi]
+				for key, v := range f.KV {
+					pr := rt.propNameLookup[key]
+					if pr == nil || pr.Type != "node" || v != from {
+						continue
+					}
+					e.setKV(f, key, to)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// setKV sets a key in the field KV. The KV map is copied before it is changed
+// as it may be shared.
+func (e *Editor) setKV(f *Field, key string, value interface{}) {
+	kv := make(KV, len(f.KV)+1)
+	for k, v := range f.KV {
+		kv[k] = v
+	}
+	if value == nil {
+		delete(kv, key)
+	} else {
+		kv[key] = value
+	}
+	f.KV = kv
+}
+
+// SetValue sets the field key to value. A nil value removes the key from the field.
+func (e *Editor) SetValue(node, role string, field int, key string, value interface{}) error {
+	f, err := e.field(node, role, field)
+	if err != nil {
+		return err
+	}
+	e.setKV(f, key, value)
+	return nil
+}
+
+// AddField appends a field to the node role.
+func (e *Editor) AddField(node, role string, f Field) error {
+	n, err := e.node(node)
+	if err != nil {
+		return err
+	}
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		if r.Name != role {
+			continue
+		}
+		r.Fields = append(r.Fields[:len(r.Fields):len(r.Fields)], Field{ID: f.ID, Alias: f.Alias, KV: f.KV})
+		return nil
+	}
+	return fmt.Errorf("bus: edit node %q role %q not found", node, role)
+}
+
+// RemoveField removes the field at the index from the node role.
+func (e *Editor) RemoveField(node, role string, field int) error {
+	if _, err := e.field(node, role, field); err != nil {
+		return err
+	}
+	n, _ := e.node(node)
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		if r.Name != role {
+			continue
+		}
+		list := make([]Field, 0, len(r.Fields)-1)
+		list = append(list, r.Fields[:field]...)
+		r.Fields = append(list, r.Fields[field+1:]...)
+	}
+	return nil
+}
+
+// AddBind binds the node to another node with an alias.
+func (e *Editor) AddBind(node string, bd Bind) error {
+	n, err := e.node(node)
+	if err != nil {
+		return err
+	}
+	for _, existing := range n.Binds {
+		if existing.Alias == bd.Alias {
+			return fmt.Errorf("bus: edit node %q already bound alias %q", node, bd.Alias)
+		}
+	}
+	n.Binds = append(n.Binds[:len(n.Binds):len(n.Binds)], Bind{Alias: bd.Alias, Name: bd.Name})
+	return nil
+}
+
+// RemoveBind removes the bind alias from the node.
+// Any fields using the alias must also be changed.
+func (e *Editor) RemoveBind(node, alias string) error {
+	n, err := e.node(node)
+	if err != nil {
+		return err
+	}
+	for i, bd := range n.Binds {
+		if bd.Alias != alias {
+			continue
+		}
+		list := make([]Bind, 0, len(n.Binds)-1)
+		list = append(list, n.Binds[:i]...)
+		n.Binds = append(list, n.Binds[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("bus: edit node %q bind alias %q not found", node, alias)
+}
@@ -0,0 +1,127 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+	"solidcoredata.org/src/databus/bus/load"
+)
+
+func TestEdit(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/test/table",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true, Send: true},
+                        {Name: "type", Type: "text", Send: true},
+                        {Name: "fk", Type: "node", Optional: true},
+                    ],
+                },
+            ],
+        },
+        {
+            Name: "solidcoredata.org/test/ui",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text"},
+                        {Name: "type", Type: "text", Recv: true},
+                    ],
+                },
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "genre",
+            Type: "solidcoredata.org/test/table",
+            Roles: [{Name: "schema", Fields: [{KV: {name: "id", type: "int"}}]}],
+        },
+        {
+            Name: "book",
+            Type: "solidcoredata.org/test/table",
+            Roles: [{Name: "schema", Fields: [{KV: {name: "genre", type: "int", fk: "genre"}}]}],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	if err = b.Init(); err != nil {
+		t.Fatal("validate", err)
+	}
+
+	err = b.Edit(func(e *bus.Editor) error {
+		if err := e.AddNode(bus.Node{
+			Name: "ui",
+			Type: "solidcoredata.org/test/ui",
+			Roles: []bus.Role{
+				{Name: "schema", Fields: []bus.Field{{Alias: "b", KV: bus.KV{"name": "genre"}}}},
+			},
+		}); err != nil {
+			return err
+		}
+		if err := e.AddBind("ui", bus.Bind{Alias: "b", Name: "book"}); err != nil {
+			return err
+		}
+		if err := e.RenameNode("genre", "category"); err != nil {
+			return err
+		}
+		return e.SetValue("book", "schema", 0, "type", "bigint")
+	})
+	if err != nil {
+		t.Fatal("edit", err)
+	}
+
+	if b.Node("genre") != b.Node("category") || b.Node("category").Name != "category" {
+		t.Fatal("expected renamed node with alternate name")
+	}
+	fk := b.Node("book").Role("schema").Fields[0].Value("fk").(*bus.Node)
+	if fk.Name != "category" {
+		t.Fatalf("expected fk to be renamed, got %q", fk.Name)
+	}
+	ui := b.Node("ui")
+	if got := ui.Role("schema").Fields[0].Value("type"); got != "bigint" {
+		t.Fatalf("expected received type to be updated, got %v", got)
+	}
+	if b.Nodes[len(b.Nodes)-1].Name != "ui" {
+		t.Fatal("expected ui to be sorted last")
+	}
+
+	// Removing a referenced node fails and restores the bus.
+	err = b.Edit(func(e *bus.Editor) error {
+		return e.RemoveNode("category")
+	})
+	if !errors.Is(err, bus.CodeValueInvalid) {
+		t.Fatalf("expected invalid value error, got %v", err)
+	}
+	if b.Node("category") == nil || len(b.Nodes) != 3 {
+		t.Fatal("expected bus to be restored")
+	}
+
+	err = b.Edit(func(e *bus.Editor) error {
+		if err := e.RemoveNode("ui"); err != nil {
+			return err
+		}
+		return e.RemoveField("book", "schema", 0)
+	})
+	if err != nil {
+		t.Fatal("edit remove", err)
+	}
+	if b.Node("ui") != nil || len(b.Node("book").Role("schema").Fields) != 0 {
+		t.Fatal("expected node and field to be removed")
+	}
+}
@@ -0,0 +1,337 @@
+package bus
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd/v2"
+)
+
+// canonicalBus is the canonical encoding of the bus: JSON with a fixed structure.
+// Every field value is written in its normalized form with defaults applied.
+// Decimal values are written as strings without trailing zeros, bytes values
+// as base64 strings with a "64x" prefix, and node values as the node name.
+// Dates, timestamps, and UUIDs are written as strings, and JSON values as a
+// string of JSON text.
+// Map keys are sorted and node types and nodes are written sorted by name,
+// so two equal buses will always encode to identical bytes. The canonical
+// encoding may be read with DecodeCanonical or with the standard bus loader.
+type canonicalBus struct {
+	Version Version
+	Types   []canonicalNodeType
+	Nodes   []canonicalNode
+	Scripts []Script `json:",omitempty"`
+}
+
+type canonicalNodeType struct {
+	Name       string
+	Extends    []string `json:",omitempty"`
+	Roles      []canonicalRoleType
+	Version    int64       `json:",omitempty"`
+	Migrations []Migration `json:",omitempty"`
+	canonicalMeta
+}
+
+// canonicalMeta is the canonical encoding of Meta. Empty values are left
+// out, so the encoding of a bus without metadata does not change.
+type canonicalMeta struct {
+	Description     string            `json:",omitempty"`
+	Owner           string            `json:",omitempty"`
+	Labels          map[string]string `json:",omitempty"`
+	DeprecatedSince string            `json:",omitempty"`
+	Replacement     string            `json:",omitempty"`
+}
+
+type canonicalRoleType struct {
+	Name       string
+	Side       Side
+	FieldCount FieldCount
+	Properties []canonicalProperty
+}
+
+type canonicalProperty struct {
+	Name        string
+	Type        string
+	FieldName   bool
+	Optional    bool
+	Send        bool
+	Recv        bool
+	Default     interface{}
+	DefaultExpr string   `json:",omitempty"`
+	Enum        []string `json:",omitempty"`
+	Min         *float64 `json:",omitempty"`
+	Max         *float64 `json:",omitempty"`
+	MaxLength   int64    `json:",omitempty"`
+	Pattern     string   `json:",omitempty"`
+	NodeTypes   []string `json:",omitempty"`
+}
+
+type canonicalNode struct {
+	Name    string
+	NameAlt []string
+	Type    string
+	Roles   []canonicalRole
+	Binds   []Bind
+	Package string `json:",omitempty"`
+	canonicalMeta
+}
+
+type canonicalRole struct {
+	Name   string
+	Fields []canonicalField
+}
+
+type canonicalField struct {
+	ID    int64
+	Alias string
+	KV    KV
+}
+
+// EncodeCanonical writes the canonical encoding of the bus to w.
+// The bus is initialized first and must be valid.
+func (b *Bus) EncodeCanonical(w io.Writer) error {
+	if err := b.Init(); err != nil {
+		return err
+	}
+	cb := canonicalBus{
+		Version: b.Version,
+		Types:   make([]canonicalNodeType, len(b.Types)),
+		Nodes:   make([]canonicalNode, len(b.Nodes)),
+		Scripts: b.Scripts,
+	}
+	for i := range b.Types {
+		nt := &b.Types[i]
+		cnt := canonicalNodeType{
+			Name:          nt.Name,
+			Extends:       append([]string{}, nt.Extends...),
+			Roles:         make([]canonicalRoleType, len(nt.Roles)),
+			canonicalMeta: canonicalMeta(nt.Meta),
+
+			Version:    nt.Version,
+			Migrations: append([]Migration{}, nt.Migrations...),
+		}
+		for ri := range nt.Roles {
+			rt := &nt.Roles[ri]
+			crt := canonicalRoleType{
+				Name:       rt.Name,
+				Side:       rt.Side,
+				FieldCount: rt.FieldCount,
+				Properties: make([]canonicalProperty, len(rt.Properties)),
+			}
+			for pi := range rt.Properties {
+				pr := &rt.Properties[pi]
+				// Defaults are normalized on the declared and inherited roles.
+				if pr = nt.RoleType(rt.Name).Property(pr.Name); pr == nil {
+					pr = &rt.Properties[pi]
+				}
+				def, err := canonicalValue(pr.defaultValue)
+				if err != nil {
+					return fmt.Errorf("bus: node type %q role %q property %q default: %w", nt.Name, rt.Name, pr.Name, err)
+				}
+				crt.Properties[pi] = canonicalProperty{
+					Name:        pr.Name,
+					Type:        pr.Type,
+					FieldName:   pr.FieldName,
+					Optional:    pr.Optional,
+					Send:        pr.Send,
+					Recv:        pr.Recv,
+					Default:     def,
+					DefaultExpr: pr.DefaultExpr,
+					Enum:        append([]string{}, pr.Enum...),
+					Min:         pr.Min,
+					Max:         pr.Max,
+					MaxLength:   pr.MaxLength,
+					Pattern:     pr.Pattern,
+					NodeTypes:   append([]string{}, pr.NodeTypes...),
+				}
+			}
+			cnt.Roles[ri] = crt
+		}
+		cb.Types[i] = cnt
+	}
+	for i := range b.Nodes {
+		n := &b.Nodes[i]
+		cn := canonicalNode{
+			Name:          n.Name,
+			NameAlt:       append([]string{}, n.NameAlt...),
+			Type:          n.Type,
+			Roles:         make([]canonicalRole, len(n.Roles)),
+			Binds:         make([]Bind, len(n.Binds)),
+			Package:       n.Package,
+			canonicalMeta: canonicalMeta(n.Meta),
+		}
+		for bi, bd := range n.Binds {
+			cn.Binds[bi] = Bind{Alias: bd.Alias, Name: bd.Name}
+		}
+		for ri := range n.Roles {
+			r := &n.Roles[ri]
+			cr := canonicalRole{
+				Name:   r.Name,
+				Fields: make([]canonicalField, len(r.Fields)),
+			}
+			for fi := range r.Fields {
+				f := &r.Fields[fi]
+				kv := make(KV, len(f.values))
+				for key, v := range f.values {
+					if v == nil {
+						continue
+					}
+					cv, err := canonicalValue(v)
+					if err != nil {
+						return fmt.Errorf("bus: node %q role %q field index %d key %q: %w", n.Name, r.Name, fi, key, err)
+					}
+					kv[key] = cv
+				}
+				cr.Fields[fi] = canonicalField{
+					ID:    f.ID,
+					Alias: f.Alias,
+					KV:    kv,
+				}
+			}
+			cn.Roles[ri] = cr
+		}
+		cb.Nodes[i] = cn
+	}
+	sort.Slice(cb.Types, func(i, j int) bool {
+		return cb.Types[i].Name < cb.Types[j].Name
+	})
+	sort.Slice(cb.Nodes, func(i, j int) bool {
+		return cb.Nodes[i].Name < cb.Nodes[j].Name
+	})
+
+	coder := json.NewEncoder(w)
+	coder.SetEscapeHTML(false)
+	coder.SetIndent("", "\t")
+	return coder.Encode(cb)
+}
+
+// MarshalCanonical returns the canonical encoding of the bus.
+func (b *Bus) MarshalCanonical() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := b.EncodeCanonical(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeCanonical reads a bus from r and initializes it.
+func DecodeCanonical(r io.Reader) (*Bus, error) {
+	b := &Bus{}
+	coder := json.NewDecoder(r)
+	coder.DisallowUnknownFields()
+	coder.UseNumber()
+	err := coder.Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("bus: unable to decode: %w", err)
+	}
+	return b, b.Init()
+}
+
+// canonicalValue returns the canonical representation of a normalized value.
+// Keep in sync with validValue.
+func canonicalValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	default:
+		return nil, fmt.Errorf("unknown value type %T", v)
+	case nil:
+		return nil, nil
+	case string, bool:
+		return v, nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case *apd.Decimal:
+		// Equal decimals, such as 1.50 and 1.5, encode the same.
+		var d apd.Decimal
+		d.Reduce(v)
+		return d.String(), nil
+	case []byte:
+		if len(v) == 0 {
+			return "", nil
+		}
+		return "64x" + base64.StdEncoding.EncodeToString(v), nil
+	case *Node:
+		return v.Name, nil
+	case Date:
+		return v.String(), nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case UUID:
+		return v.String(), nil
+	case json.RawMessage:
+		return string(v), nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			cv, err := canonicalValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = cv
+		}
+		return list, nil
+	}
+}
+
+type versionJSON struct {
+	Version    int64
+	Sequence   int64
+	Identifier string
+}
+
+// MarshalJSON encodes the Identifier as a hex string.
+func (v Version) MarshalJSON() ([]byte, error) {
+	return json.Marshal(versionJSON{
+		Version:    v.Version,
+		Sequence:   v.Sequence,
+		Identifier: hex.EncodeToString(v.Identifier[:]),
+	})
+}
+
+// UnmarshalJSON decodes the Identifier from a hex string.
+// An Identifier encoded as a list of numbers is also accepted.
+func (v *Version) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Version    int64
+		Sequence   int64
+		Identifier json.RawMessage
+	}
+	coder := json.NewDecoder(bytes.NewReader(data))
+	coder.DisallowUnknownFields()
+	err := coder.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	v.Version = raw.Version
+	v.Sequence = raw.Sequence
+	v.Identifier = [len(v.Identifier)]byte{}
+
+	if len(raw.Identifier) == 0 || string(raw.Identifier) == "null" {
+		return nil
+	}
+	var s string
+	if err = json.Unmarshal(raw.Identifier, &s); err != nil {
+		return json.Unmarshal(raw.Identifier, &v.Identifier)
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("bus: invalid version identifier: %w", err)
+	}
+	if len(id) != len(v.Identifier) {
+		return fmt.Errorf("bus: invalid version identifier length %d", len(id))
+	}
+	copy(v.Identifier[:], id)
+	return nil
+}
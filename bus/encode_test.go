@@ -0,0 +1,139 @@
+package bus_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+	"solidcoredata.org/src/databus/bus/load"
+
+	"github.com/cockroachdb/apd/v2"
+)
+
+func TestCanonical(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true},
+                        {Name: "price", Type: "decimal"},
+                        {Name: "blob", Type: "bytes", Default: "16x0102"},
+                        {Name: "count", Type: "int", Default: "4"},
+                        {Name: "ratio", Type: "float", Optional: true},
+                        {Name: "related", Type: "node", Optional: true},
+                    ],
+                },
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "node2",
+            Type: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Fields: [
+                        {Alias: "n1", KV: {ratio: 1.5, name: "books", price: "123.4560", related: "node1"}},
+                    ],
+                },
+            ],
+            Binds: [
+                {Alias: "n1", Name: "node1"},
+            ],
+        },
+        {
+            Name: "node1",
+            Type: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Fields: [
+                        {KV: {name: "books", price: "123.456", blob: "64xAwQ="}},
+                    ],
+                },
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b1, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	out1, err := b1.MarshalCanonical()
+	if err != nil {
+		t.Fatal("encode", err)
+	}
+
+	// Properties of features the bus does not use are left out, so the
+	// encoding of the bus does not change when features are added.
+	for _, key := range []string{"Extends", "Migrations", "Package", "Description", "DefaultExpr", "Enum", "Pattern"} {
+		if bytes.Contains(out1, []byte(`"`+key+`"`)) {
+			t.Errorf("unused %q in canonical encoding:\n%s", key, out1)
+		}
+	}
+
+	// Equal decimals written differently encode the same.
+	b4, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, strings.Replace(input, `"123.4560"`, `"123.456"`, 1))))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	out4, err := b4.MarshalCanonical()
+	if err != nil {
+		t.Fatal("encode", err)
+	}
+	if !bytes.Equal(out1, out4) {
+		t.Fatalf("equal decimals not encoded the same:\n%s\n\n%s", out1, out4)
+	}
+
+	b2, err := bus.DecodeCanonical(bytes.NewReader(out1))
+	if err != nil {
+		t.Fatal("decode", err)
+	}
+	out2, err := b2.MarshalCanonical()
+	if err != nil {
+		t.Fatal("encode", err)
+	}
+	if !bytes.Equal(out1, out2) {
+		t.Fatalf("round trip not identical:\n%s\n\n%s", out1, out2)
+	}
+
+	b3, err := load.BusReader(ctx, bytes.NewReader(out1))
+	if err != nil {
+		t.Fatal("load canonical", err)
+	}
+	if err = b3.Init(); err != nil {
+		t.Fatal("init canonical", err)
+	}
+
+	f1 := b3.Node("node1").Role("p1").Fields[0]
+	if got := f1.Value("blob").([]byte); !bytes.Equal(got, []byte{3, 4}) {
+		t.Errorf("blob: got %v", got)
+	}
+	if got := f1.Value("count").(int64); got != 4 {
+		t.Errorf("count: got %v", got)
+	}
+	f2 := b3.Node("node2").Role("p1").Fields[0]
+	if got := f2.Value("blob").([]byte); !bytes.Equal(got, []byte{1, 2}) {
+		t.Errorf("default blob: got %v", got)
+	}
+	if got := f2.Value("price").(*apd.Decimal).String(); got != "123.456" {
+		t.Errorf("price: got %v", got)
+	}
+	if got := f2.Value("ratio").(float64); got != 1.5 {
+		t.Errorf("ratio: got %v", got)
+	}
+	if got := f2.Value("related").(*bus.Node); got != b3.Node("node1") {
+		t.Errorf("related: got %v", got)
+	}
+}
@@ -0,0 +1,140 @@
+package bus
+
+// extend sets the roles of the node type, including the roles inherited
+// from the base node types. Base node types are extended first.
+// visiting contains the node types currently being extended. A node type
+// is done once bases is set, even if it has no roles.
+func (b *Bus) extend(nt *NodeType, visiting map[string]bool) *Errors {
+	if nt.bases != nil {
+		return nil
+	}
+	var errs *Errors
+	if visiting[nt.Name] {
+		return errs.add(CodeExtendBase, locType(nt.Name, "", ""), "node type extends itself through its base node types")
+	}
+	if len(nt.Extends) == 0 {
+		nt.roles = nt.Roles
+		nt.bases = map[string]bool{}
+		return nil
+	}
+
+	visiting[nt.Name] = true
+	defer delete(visiting, nt.Name)
+
+	bases := make(map[string]bool, len(nt.Extends))
+	roles := make([]RoleType, 0, len(nt.Roles))
+	index := make(map[string]int, len(nt.Roles))
+
+	for _, name := range nt.Extends {
+		base, ok := b.typeLookup[name]
+		if !ok {
+			errs = errs.add(CodeExtendBase, locType(nt.Name, "", ""), "base node type %q not found", name)
+			continue
+		}
+		errs = errs.Append(b.extend(base, visiting))
+		if base.bases == nil {
+			// Base is in a cycle.
+			continue
+		}
+		bases[name] = true
+		for bn := range base.bases {
+			bases[bn] = true
+		}
+		for _, rt := range base.roles {
+			roles, errs = inherit(nt.Name, roles, index, rt, false, errs)
+		}
+	}
+	declared := make(map[string]bool, len(nt.Roles))
+	for _, rt := range nt.Roles {
+		if declared[rt.Name] {
+			errs = errs.add(CodeRoleDuplicate, locType(nt.Name, rt.Name, ""), "role re-defined")
+			continue
+		}
+		declared[rt.Name] = true
+		roles, errs = inherit(nt.Name, roles, index, rt, true, errs)
+	}
+	nt.roles = roles
+	nt.bases = bases
+	return errs
+}
+
+// inherit adds the role type rt to roles, or applies it to the role of the
+// same name already in roles. If declared is true, duplicate properties
+// within rt are reported.
+func inherit(typeName string, roles []RoleType, index map[string]int, rt RoleType, declared bool, errs *Errors) ([]RoleType, *Errors) {
+	ri, ok := index[rt.Name]
+	if !ok {
+		rt.Properties = append([]Property(nil), rt.Properties...)
+		rt.propNameLookup = nil
+		index[rt.Name] = len(roles)
+		return append(roles, rt), errs
+	}
+	r := &roles[ri]
+	if r.Side != rt.Side {
+		return roles, errs.add(CodeExtendOverride, locType(typeName, rt.Name, ""), "side %d differs from inherited side %d", rt.Side, r.Side)
+	}
+	if r.FieldCount != rt.FieldCount {
+		return roles, errs.add(CodeExtendOverride, locType(typeName, rt.Name, ""), "FieldCount %d differs from inherited FieldCount %d", rt.FieldCount, r.FieldCount)
+	}
+	seen := make(map[string]bool, len(rt.Properties))
+	for _, pr := range rt.Properties {
+		if declared && seen[pr.Name] {
+			errs = errs.add(CodePropertyDuplicate, locType(typeName, rt.Name, pr.Name), "property re-defined")
+			continue
+		}
+		seen[pr.Name] = true
+		pi := -1
+		for i := range r.Properties {
+			if r.Properties[i].Name == pr.Name {
+				pi = i
+				break
+			}
+		}
+		if pi < 0 {
+			r.Properties = append(r.Properties, pr)
+			continue
+		}
+		base := r.Properties[pi]
+		switch {
+		case base.Type != pr.Type:
+			errs = errs.add(CodeExtendOverride, locType(typeName, rt.Name, pr.Name), "type %q differs from inherited type %q", pr.Type, base.Type)
+			continue
+		case base.FieldName != pr.FieldName:
+			errs = errs.add(CodeExtendOverride, locType(typeName, rt.Name, pr.Name), "FieldName %t differs from inherited FieldName %t", pr.FieldName, base.FieldName)
+			continue
+		case !base.Optional && pr.Optional:
+			errs = errs.add(CodeExtendOverride, locType(typeName, rt.Name, pr.Name), "may not be optional, inherited property is required")
+			continue
+		}
+		r.Properties[pi] = pr
+	}
+	return roles, errs
+}
+
+// IsA reports if the node type is named name or extends the node type
+// named name, directly or indirectly. The bus must be initialized.
+func (nt *NodeType) IsA(name string) bool {
+	if nt == nil {
+		return false
+	}
+	return nt.Name == name || nt.bases[name]
+}
+
+// IsA reports if the node type is named name or extends the node type
+// named name. If the node type of an external node is not in the bus,
+// only the type name is compared.
+func (n *Node) IsA(name string) bool {
+	if n == nil {
+		return false
+	}
+	if n.nodeType == nil {
+		return n.Type == name
+	}
+	return n.nodeType.IsA(name)
+}
+
+// AllRoles returns the declared and inherited roles of the node type.
+// The bus must be initialized.
+func (nt *NodeType) AllRoles() []RoleType {
+	return nt.roles
+}
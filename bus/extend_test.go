@@ -0,0 +1,199 @@
+package bus_test
+
+import (
+	"errors"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestExtend(t *testing.T) {
+	object := bus.NodeType{
+		Name: "solidcoredata.org/test/object",
+		Roles: []bus.RoleType{
+			{
+				Name:       "prop",
+				FieldCount: bus.One,
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "comment", Type: "text", Optional: true},
+				},
+			},
+		},
+	}
+	table := bus.NodeType{
+		Name:    "solidcoredata.org/test/table",
+		Extends: []string{object.Name},
+		Roles: []bus.RoleType{
+			{
+				Name:       "prop",
+				FieldCount: bus.One,
+				Properties: []bus.Property{
+					{Name: "comment", Type: "text", Default: "none"},
+					{Name: "parent", Type: "node", Optional: true, NodeTypes: []string{object.Name}},
+				},
+			},
+		},
+	}
+	view := bus.NodeType{
+		Name:    "solidcoredata.org/test/view",
+		Extends: []string{table.Name},
+	}
+	prop := func(kv bus.KV) []bus.Role {
+		return []bus.Role{{Name: "prop", Fields: []bus.Field{{KV: kv}}}}
+	}
+	b := &bus.Bus{
+		Types: []bus.NodeType{object, table, view},
+		Nodes: []bus.Node{
+			{Name: "book", Type: table.Name, Roles: prop(bus.KV{"name": "book"})},
+			{Name: "book_list", Type: view.Name, Roles: prop(bus.KV{"name": "book_list", "parent": "book"})},
+		},
+	}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := b.NodeType(view.Name).RoleType("prop")
+	if rt == nil {
+		t.Fatal("view missing inherited prop role")
+	}
+	var names []string
+	for _, pr := range rt.Properties {
+		names = append(names, pr.Name)
+	}
+	if g, w := len(names), 3; g != w {
+		t.Fatalf("got properties %q, want %d properties", names, w)
+	}
+	f := b.Node("book").Role("prop").Fields[0]
+	if g, w := f.Value("comment"), "none"; g != w {
+		t.Fatalf("got comment %v, want overridden default %q", g, w)
+	}
+	list := b.Node("book_list")
+	for _, name := range []string{view.Name, table.Name, object.Name} {
+		if !list.IsA(name) {
+			t.Fatalf("book_list is not a %q", name)
+		}
+	}
+	if b.Node("book").IsA(view.Name) {
+		t.Fatalf("book is a %q", view.Name)
+	}
+
+	// Filter keeps the base types of the handled types.
+	fb := b.Filter([]string{view.Name}, bus.SideBoth)
+	if err := fb.InitWith(bus.InitOptions{AllowExternal: true}); err != nil {
+		t.Fatal(err)
+	}
+	if fb.NodeType(object.Name) == nil || fb.NodeType(table.Name) == nil {
+		t.Fatal("filter dropped base node types")
+	}
+	if fb.Node("book") != nil {
+		t.Fatal("filter kept node of base node type")
+	}
+
+	list2 := []struct {
+		name  string
+		types []bus.NodeType
+		code  bus.Code
+	}{
+		{
+			name: "missing-base",
+			types: []bus.NodeType{
+				{Name: "a", Extends: []string{"b"}},
+			},
+			code: bus.CodeExtendBase,
+		},
+		{
+			name: "cycle",
+			types: []bus.NodeType{
+				{Name: "a", Extends: []string{"b"}},
+				{Name: "b", Extends: []string{"a"}},
+			},
+			code: bus.CodeExtendBase,
+		},
+		{
+			name: "type-change",
+			types: []bus.NodeType{
+				object,
+				{
+					Name:    "a",
+					Extends: []string{object.Name},
+					Roles: []bus.RoleType{
+						{Name: "prop", FieldCount: bus.One, Properties: []bus.Property{{Name: "name", Type: "int", FieldName: true}}},
+					},
+				},
+			},
+			code: bus.CodeExtendOverride,
+		},
+		{
+			name: "optional",
+			types: []bus.NodeType{
+				object,
+				{
+					Name:    "a",
+					Extends: []string{object.Name},
+					Roles: []bus.RoleType{
+						{Name: "prop", FieldCount: bus.One, Properties: []bus.Property{{Name: "name", Type: "text", FieldName: true, Optional: true}}},
+					},
+				},
+			},
+			code: bus.CodeExtendOverride,
+		},
+		{
+			name: "field-count",
+			types: []bus.NodeType{
+				object,
+				{
+					Name:    "a",
+					Extends: []string{object.Name},
+					Roles: []bus.RoleType{
+						{Name: "prop", FieldCount: bus.OnePlus, Properties: []bus.Property{{Name: "other", Type: "text"}}},
+					},
+				},
+			},
+			code: bus.CodeExtendOverride,
+		},
+	}
+	for _, item := range list2 {
+		t.Run(item.name, func(t *testing.T) {
+			b := &bus.Bus{Types: item.types}
+			err := b.Init()
+			if !errors.Is(err, item.code) {
+				t.Fatalf("expected %q, got %v", item.code, err)
+			}
+		})
+	}
+}
+
+func TestExtendMarker(t *testing.T) {
+	marker := bus.NodeType{Name: "solidcoredata.org/test/marker"}
+	table := bus.NodeType{
+		Name:    "solidcoredata.org/test/table",
+		Extends: []string{marker.Name},
+		Roles: []bus.RoleType{
+			{
+				Name:       "prop",
+				FieldCount: bus.One,
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "parent", Type: "node", Optional: true, NodeTypes: []string{marker.Name}},
+				},
+			},
+		},
+	}
+	prop := func(kv bus.KV) []bus.Role {
+		return []bus.Role{{Name: "prop", Fields: []bus.Field{{KV: kv}}}}
+	}
+	b := &bus.Bus{
+		Types: []bus.NodeType{marker, table},
+		Nodes: []bus.Node{
+			{Name: "author", Type: table.Name, Roles: prop(bus.KV{"name": "author"})},
+			{Name: "book", Type: table.Name, Roles: prop(bus.KV{"name": "book", "parent": "author"})},
+		},
+	}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Node("book").IsA(marker.Name) {
+		t.Fatalf("book is not a %q", marker.Name)
+	}
+}
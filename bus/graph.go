@@ -0,0 +1,195 @@
+package bus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GraphFormat is the output format of WriteGraph.
+type GraphFormat string
+
+const (
+	GraphDOT     GraphFormat = "dot"     // Graphviz DOT.
+	GraphMermaid GraphFormat = "mermaid" // Mermaid flowchart.
+)
+
+// GraphOptions configure WriteGraph.
+type GraphOptions struct {
+	Format GraphFormat
+
+	// Types of nodes to include. A node is included if it is a node of
+	// the type or a type that extends it. If empty, all nodes are included.
+	Types []string
+
+	// Delta, if set, highlights the nodes of the bus added or changed in the delta.
+	Delta *DeltaBus
+}
+
+type graphEdge struct {
+	from, to string
+	label    string
+	bind     bool
+}
+
+// WriteGraph writes the node dependency graph to w. Each bind and each node
+// value of a field is an edge from the node to the referenced node.
+// References to nodes that are not included are omitted.
+func (b *Bus) WriteGraph(w io.Writer, opts GraphOptions) error {
+	if err := b.Init(); err != nil {
+		return err
+	}
+	include := func(n *Node) bool {
+		if len(opts.Types) == 0 {
+			return true
+		}
+		for _, t := range opts.Types {
+			if n.IsA(t) {
+				return true
+			}
+		}
+		return false
+	}
+	var nodes []*Node
+	ids := make(map[string]string, len(b.Nodes))
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		if !include(n) {
+			continue
+		}
+		ids[n.Name] = "n" + strconv.Itoa(len(nodes))
+		nodes = append(nodes, n)
+	}
+	var edges []graphEdge
+	for _, n := range nodes {
+		for _, bd := range n.Binds {
+			if bd.node == nil {
+				continue
+			}
+			if _, ok := ids[bd.node.Name]; !ok {
+				continue
+			}
+			edges = append(edges, graphEdge{from: n.Name, to: bd.node.Name, label: bd.Alias, bind: true})
+		}
+		for _, r := range n.Roles {
+			for fi := range r.Fields {
+				f := &r.Fields[fi]
+				keys := make([]string, 0, len(f.values))
+				for key := range f.values {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					to, ok := f.values[key].(*Node)
+					if !ok {
+						continue
+					}
+					if _, ok := ids[to.Name]; !ok {
+						continue
+					}
+					name := f.name
+					if len(name) == 0 {
+						name = strconv.Itoa(fi)
+					}
+					edges = append(edges, graphEdge{from: n.Name, to: to.Name, label: r.Name + "[" + name + "]." + key})
+				}
+			}
+		}
+	}
+
+	// change by node name, either "added" or "changed".
+	change := make(map[string]string)
+	if opts.Delta != nil {
+		for _, a := range opts.Delta.Actions {
+			if a.NodeCurrent == nil {
+				continue
+			}
+			switch {
+			case a.Alter == AlterNodeAdd:
+				change[a.NodeCurrent.Name] = "added"
+			case len(change[a.NodeCurrent.Name]) == 0:
+				change[a.NodeCurrent.Name] = "changed"
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	switch opts.Format {
+	default:
+		return fmt.Errorf("bus: unknown graph format %q", opts.Format)
+	case GraphDOT, "":
+		writeDOT(bw, nodes, edges, change)
+	case GraphMermaid:
+		writeMermaid(bw, nodes, ids, edges, change)
+	}
+	return bw.Flush()
+}
+
+func writeDOT(w *bufio.Writer, nodes []*Node, edges []graphEdge, change map[string]string) {
+	w.WriteString("digraph bus {\n")
+	w.WriteString("\trankdir=LR;\n")
+	w.WriteString("\tnode [shape=box];\n")
+	for _, n := range nodes {
+		attr := ""
+		switch change[n.Name] {
+		case "added":
+			attr = ", style=filled, fillcolor=palegreen"
+		case "changed":
+			attr = ", style=filled, fillcolor=lightgoldenrod"
+		}
+		fmt.Fprintf(w, "\t%s [label=%s%s];\n", dotQuote(n.Name), dotQuote(n.Name+"\n"+n.Type), attr)
+	}
+	for _, e := range edges {
+		style := ""
+		if !e.bind {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "\t%s -> %s [label=%s%s];\n", dotQuote(e.from), dotQuote(e.to), dotQuote(e.label), style)
+	}
+	w.WriteString("}\n")
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func writeMermaid(w *bufio.Writer, nodes []*Node, ids map[string]string, edges []graphEdge, change map[string]string) {
+	w.WriteString("graph LR\n")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "\t%s[\"%s<br/>%s\"]\n", ids[n.Name], mermaidEscape(n.Name), mermaidEscape(n.Type))
+	}
+	for _, e := range edges {
+		arrow := "-->"
+		if !e.bind {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "\t%s %s|\"%s\"| %s\n", ids[e.from], arrow, mermaidEscape(e.label), ids[e.to])
+	}
+	var added, changed []string
+	for _, n := range nodes {
+		switch change[n.Name] {
+		case "added":
+			added = append(added, ids[n.Name])
+		case "changed":
+			changed = append(changed, ids[n.Name])
+		}
+	}
+	if len(added) > 0 {
+		w.WriteString("\tclassDef added fill:#cfc\n")
+		fmt.Fprintf(w, "\tclass %s added\n", strings.Join(added, ","))
+	}
+	if len(changed) > 0 {
+		w.WriteString("\tclassDef changed fill:#fe9\n")
+		fmt.Fprintf(w, "\tclass %s changed\n", strings.Join(changed, ","))
+	}
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
@@ -0,0 +1,97 @@
+package bus_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestGraph(t *testing.T) {
+	table := bus.NodeType{
+		Name: "solidcoredata.org/test/table",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "fk", Type: "node", Optional: true},
+				},
+			},
+		},
+	}
+	ui := bus.NodeType{
+		Name: "solidcoredata.org/test/ui",
+		Roles: []bus.RoleType{
+			{Name: "schema", Properties: []bus.Property{{Name: "name", Type: "text"}}},
+		},
+	}
+	schema := func(fields ...bus.Field) []bus.Role {
+		return []bus.Role{{Name: "schema", Fields: fields}}
+	}
+	newBus := func() *bus.Bus {
+		return &bus.Bus{
+			Types: []bus.NodeType{table, ui},
+			Nodes: []bus.Node{
+				{Name: "genre", Type: table.Name, Roles: schema(bus.Field{KV: bus.KV{"name": "id"}})},
+				{Name: "book", Type: table.Name, Roles: schema(bus.Field{KV: bus.KV{"name": "genre", "fk": "genre"}})},
+				{
+					Name:  "book_ui",
+					Type:  ui.Name,
+					Binds: []bus.Bind{{Alias: "b", Name: "book"}},
+					Roles: schema(bus.Field{Alias: "b", KV: bus.KV{"name": "genre"}}),
+				},
+			},
+		}
+	}
+	b := newBus()
+
+	buf := &bytes.Buffer{}
+	if err := b.WriteGraph(buf, bus.GraphOptions{Format: bus.GraphDOT}); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph bus {
+	rankdir=LR;
+	node [shape=box];
+	"genre" [label="genre\nsolidcoredata.org/test/table"];
+	"book" [label="book\nsolidcoredata.org/test/table"];
+	"book_ui" [label="book_ui\nsolidcoredata.org/test/ui"];
+	"book" -> "genre" [label="schema[genre].fk", style=dashed];
+	"book_ui" -> "book" [label="b"];
+}
+`
+	if g := buf.String(); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+
+	// Only tables, with the changed node highlighted.
+	previous := newBus()
+	previous.Nodes[1].Roles = schema(bus.Field{KV: bus.KV{"name": "genre"}})
+	delta, err := bus.NewDelta(b, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = b.WriteGraph(buf, bus.GraphOptions{
+		Format: bus.GraphMermaid,
+		Types:  []string{table.Name},
+		Delta:  delta,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `graph LR
+	n0["genre<br/>solidcoredata.org/test/table"]
+	n1["book<br/>solidcoredata.org/test/table"]
+	n1 -.->|"schema[genre].fk"| n0
+	classDef changed fill:#fe9
+	class n1 changed
+`
+	if g := buf.String(); g != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", g, want)
+	}
+	if strings.Contains(buf.String(), "book_ui") {
+		t.Fatal("filtered node in graph")
+	}
+}
@@ -0,0 +1,45 @@
+package bus
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+)
+
+// Hash returns the SHA-512 hash of the canonical encoding of the bus.
+// The bus is initialized first, which sorts and links its nodes, and
+// must be valid.
+// The Version is not part of the hash, so the same bus content
+// will always have the same hash regardless of when it was committed.
+func (b *Bus) Hash() ([sha512.Size]byte, error) {
+	if err := b.Init(); err != nil {
+		return [sha512.Size]byte{}, fmt.Errorf("bus: unable to encode bus for hash: %w", err)
+	}
+	x := *b
+	x.Version = Version{}
+
+	h := sha512.New()
+	err := x.EncodeCanonical(h)
+	if err != nil {
+		return [sha512.Size]byte{}, fmt.Errorf("bus: unable to encode bus for hash: %w", err)
+	}
+	var sum [sha512.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// VerifyIdentifier checks that the Version Identifier matches the bus content.
+// A zero Identifier is an error, as every committed bus has one.
+func (b *Bus) VerifyIdentifier() error {
+	if b.Version.Identifier == ([sha512.Size]byte{}) {
+		return fmt.Errorf("bus: version %d has no identifier", b.Version.Sequence)
+	}
+	h, err := b.Hash()
+	if err != nil {
+		return err
+	}
+	if h != b.Version.Identifier {
+		return fmt.Errorf("bus: version %d identifier %s does not match content hash %s", b.Version.Sequence, hex.EncodeToString(b.Version.Identifier[:]), hex.EncodeToString(h[:]))
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cockroachdb/apd/v2"
 	"solidcoredata.org/src/databus/internal/tsort"
@@ -27,12 +29,22 @@ func (bs *bussort) Swap(i, j int) {
 	bs.Nodes[i], bs.Nodes[j] = bs.Nodes[j], bs.Nodes[i]
 }
 
+// InitOptions configure how a bus is initialized.
+type InitOptions struct {
+	// AllowExternal creates a placeholder node for each node reference
+	// that is not present in the bus rather then returning an error.
+	// Useful when init a partial bus sent to extensions.
+	AllowExternal bool
+}
+
 // Init should populate lookup fields, as well as return
 // any basic errors such as duplicate names.
-//
-// TODO(daniel.theophanes): Add an option to ignore missing node ref names.
-// Will be useful when init a partial bus sent to runners.
 func (b *Bus) Init() error {
+	return b.InitWith(InitOptions{})
+}
+
+// InitWith is the same as Init, but with the given options.
+func (b *Bus) InitWith(opts InitOptions) error {
 	if b == nil {
 		return nil
 	}
@@ -41,6 +53,13 @@ func (b *Bus) Init() error {
 	}
 	var errs *Errors
 
+	b.opts = opts
+	b.externalLookup = make(map[string]*Node)
+	findNode := b.Node
+	if opts.AllowExternal {
+		findNode = b.nodeOrExternal
+	}
+
 	b.nodeLookup = make(map[string]*Node, len(b.Nodes))
 	b.typeLookup = make(map[string]*NodeType, len(b.Types))
 	b.nodeByType = make(map[string][]*Node, len(b.Types))
@@ -48,23 +67,44 @@ func (b *Bus) Init() error {
 	for ni := range b.Types {
 		nt := &b.Types[ni]
 		nt.roleLookup = make(map[string]*RoleType, len(nt.Roles))
+		nt.roles = nil
+		nt.bases = nil
 
 		if _, ok := b.typeLookup[nt.Name]; ok {
-			errs = errs.AppendMsg("bus: node type %q already defined", nt.Name)
+			errs = errs.add(CodeTypeDuplicate, locType(nt.Name, "", ""), "node type already defined")
 			continue
 		}
 		b.typeLookup[nt.Name] = nt
-		for ri := range nt.Roles {
-			r := &nt.Roles[ri]
+		errs = errs.Append(nt.checkMigrations())
+	}
+	for ni := range b.Types {
+		nt := &b.Types[ni]
+		if b.typeLookup[nt.Name] != nt {
+			continue
+		}
+		errs = errs.Append(b.extend(nt, make(map[string]bool)))
+	}
+	for ni := range b.Types {
+		nt := &b.Types[ni]
+		if b.typeLookup[nt.Name] != nt {
+			continue
+		}
+		for ri := range nt.roles {
+			r := &nt.roles[ri]
 			r.propNameLookup = make(map[string]*Property, len(r.Properties))
 			if _, ok := nt.roleLookup[r.Name]; ok {
-				errs = errs.AppendMsg("bus: node type %q re-defines role %q", nt.Name, r.Name)
+				errs = errs.add(CodeRoleDuplicate, locType(nt.Name, r.Name, ""), "role re-defined")
 				continue
 			}
 			nt.roleLookup[r.Name] = r
 
+			switch r.Side {
+			default:
+				errs = errs.add(CodeSideInvalid, locType(nt.Name, r.Name, ""), "unknown side %d", r.Side)
+			case SideBoth, SideLeft, SideRight:
+			}
 			if len(r.Properties) == 0 {
-				errs = errs.AppendMsg("bus: node type %q role %q contains zero properties, at least one is required", nt.Name, r.Name)
+				errs = errs.add(CodeRoleEmpty, locType(nt.Name, r.Name, ""), "contains zero properties, at least one is required")
 			}
 
 			for ri := range r.Properties {
@@ -72,17 +112,33 @@ func (b *Bus) Init() error {
 				pr.defaultValue = nil
 
 				if _, ok := r.propNameLookup[pr.Name]; ok {
-					errs = errs.AppendMsg("bus: node type %q role %q re-defines property %q", nt.Name, r.Name, pr.Name)
+					errs = errs.add(CodePropertyDuplicate, locType(nt.Name, r.Name, pr.Name), "property re-defined")
 					continue
 				}
 				if !validType(pr.Type) {
-					errs = errs.AppendMsg("bus: node type %q role %q property %q, invalid type %q", nt.Name, r.Name, pr.Name, pr.Type)
+					errs = errs.add(CodePropertyType, locType(nt.Name, r.Name, pr.Name), "invalid type %q", pr.Type)
+					continue
+				}
+				isEnum := strings.TrimPrefix(pr.Type, listPrefix) == "enum"
+				if isEnum && len(pr.Enum) == 0 {
+					errs = errs.add(CodePropertyType, locType(nt.Name, r.Name, pr.Name), "type %q requires at least one Enum value", pr.Type)
+					continue
+				}
+				if !isEnum && len(pr.Enum) > 0 {
+					errs = errs.add(CodePropertyType, locType(nt.Name, r.Name, pr.Name), "type %q may not have Enum values", pr.Type)
+					continue
+				}
+				if err := pr.initConstraint(); err != nil {
+					errs = errs.add(CodeConstraintInvalid, locType(nt.Name, r.Name, pr.Name), "%v", err)
 					continue
 				}
 				// Validate property default.
 				if pr.Default != nil {
-					if value, err := validValue(pr.Type, pr.Default, b.Node); err != nil {
-						errs = errs.AppendMsg("bus: node type %q role %q property %q invalid default for %v: %v", nt.Name, r.Name, pr.Name, pr.Default, err)
+					if value, err := validValue(pr, pr.Default, b.Node); err != nil {
+						errs = errs.add(CodeDefaultInvalid, locType(nt.Name, r.Name, pr.Name), "invalid default for %v: %v", pr.Default, err)
+						continue
+					} else if err = pr.checkConstraint(value); err != nil {
+						errs = errs.add(CodeDefaultInvalid, locType(nt.Name, r.Name, pr.Name), "invalid default for %v: %v", pr.Default, err)
 						continue
 					} else {
 						pr.defaultValue = value
@@ -92,21 +148,26 @@ func (b *Bus) Init() error {
 			}
 		}
 	}
+	for ni := range b.Types {
+		nt := &b.Types[ni]
+		if b.typeLookup[nt.Name] != nt {
+			continue
+		}
+		errs = errs.Append(nt.initDerive())
+	}
+	errs = errs.Append(b.checkScripts())
 	for ni := range b.Nodes {
 		n := &b.Nodes[ni]
-		n.roleLookup = make(map[string]*Role, len(n.Roles))
-		n.bindAliasLookup = make(map[string]*Bind, len(n.Binds))
-		n.bindNameLookup = make(map[string][]*Bind, len(n.Binds))
 		n.nodeType = nil
 
 		if nt, ok := b.typeLookup[n.Type]; ok {
 			n.nodeType = nt
 		} else {
-			errs = errs.AppendMsg("bus: node %q missing node type %q", n.Name, n.Type)
+			errs = errs.add(CodeTypeMissing, locNode(n.Name, "", -1, ""), "missing node type %q", n.Type)
 			continue
 		}
 		if _, ok := b.nodeLookup[n.Name]; ok {
-			errs = errs.AppendMsg("bus: node %q already defined", n.Name)
+			errs = errs.add(CodeNodeDuplicate, locNode(n.Name, "", -1, ""), "node already defined")
 			continue
 		}
 		// Create bind lookups.
@@ -116,7 +177,7 @@ func (b *Bus) Init() error {
 		if len(n.NameAlt) > 0 {
 			for _, alt := range n.NameAlt {
 				if _, ok := b.nodeLookup[alt]; ok {
-					errs = errs.AppendMsg("bus: node %q already defined (alt) %q", n.Name, alt)
+					errs = errs.add(CodeNodeDuplicate, locNode(n.Name, "", -1, ""), "node already defined (alt) %q", alt)
 					continue
 				}
 				// Create bind lookups.
@@ -131,152 +192,398 @@ func (b *Bus) Init() error {
 		if n.nodeType == nil {
 			continue
 		}
-		nt := n.nodeType
+		errs = errs.Append(b.initNode(n, findNode))
+	}
+	if errs != nil {
+		return errs
+	}
+	// Sorting swaps nodes within the slice, record the names of all
+	// node pointers so they may be re-linked after the sort.
+	ptrName := make(map[*Node]string, len(b.Nodes))
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		ptrName[n] = n.Name
+	}
+	err := tsort.Sort((*bussort)(b))
+	if err != nil {
+		return errs.add(CodeCircular, Location{Field: -1}, "%v", err)
+	}
+	b.relink(ptrName)
+	// Nodes are now sorted with dependencies first, so each bound node
+	// has received its own values before sending them on.
+	errs = b.propagate()
+	errs = errs.Append(b.checkRequired(errs))
+	if errs != nil {
+		return errs
+	}
+	b.warnings = b.checkDeprecated()
+	b.setup = true
+	return nil
+}
 
-		for bi := range n.Binds {
-			bd := &n.Binds[bi]
-			bd.node = nil
+// initNode sets up the lookups of the node and checks the binds, roles,
+// and fields of the node. The node type of the node must be set.
+func (b *Bus) initNode(n *Node, findNode func(name string) *Node) *Errors {
+	var errs *Errors
+	n.roleLookup = make(map[string]*Role, len(n.Roles))
+	n.bindAliasLookup = make(map[string]*Bind, len(n.Binds))
+	n.bindNameLookup = make(map[string][]*Bind, len(n.Binds))
+	nt := n.nodeType
 
-			if len(bd.Alias) == 0 {
-				errs = errs.AppendMsg("bus: node %q bind index %d %q missing alias", n.Name, bi, bd.Name)
-				continue
-			}
-			if _, ok := n.bindAliasLookup[bd.Alias]; ok {
-				errs = errs.AppendMsg("bus: node %q already bound alias %q", n.Name, bd.Alias)
-				continue
-			}
-			if boundNode, ok := b.nodeLookup[bd.Name]; ok {
-				bd.node = boundNode
-			} else {
-				errs = errs.AppendMsg("bus: node %q bind alias %q invalid node name %q", n.Name, bd.Alias, bd.Name)
-				continue
-			}
+	for bi := range n.Binds {
+		bd := &n.Binds[bi]
+		bd.node = nil
 
-			n.bindAliasLookup[bd.Alias] = bd
-			n.bindNameLookup[bd.Name] = append(n.bindNameLookup[bd.Name], bd)
+		if len(bd.Alias) == 0 {
+			errs = errs.add(CodeBindAlias, locNode(n.Name, "", -1, ""), "bind index %d %q missing alias", bi, bd.Name)
+			continue
 		}
-		for ri := range n.Roles {
-			r := &n.Roles[ri]
-			r.fieldIDLookup = make(map[int64]*Field, len(r.Fields))
-			r.fieldNameLookup = make(map[string]*Field, len(r.Fields))
-			r.roleType = nil
-
-			if rt, ok := nt.roleLookup[r.Name]; ok {
-				r.roleType = rt
-			} else {
-				errs = errs.AppendMsg("bus: node %q role type %q not found", n.Name, r.Name)
-				continue
+		if _, ok := n.bindAliasLookup[bd.Alias]; ok {
+			errs = errs.add(CodeBindAlias, locNode(n.Name, "", -1, ""), "already bound alias %q", bd.Alias)
+			continue
+		}
+		if boundNode := findNode(bd.Name); boundNode != nil {
+			bd.node = boundNode
+		} else {
+			errs = errs.add(CodeBindNode, locNode(n.Name, "", -1, ""), "bind alias %q invalid node name %q", bd.Alias, bd.Name)
+			continue
+		}
+
+		n.bindAliasLookup[bd.Alias] = bd
+		n.bindNameLookup[bd.Name] = append(n.bindNameLookup[bd.Name], bd)
+	}
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		r.fieldIDLookup = make(map[int64]*Field, len(r.Fields))
+		r.fieldNameLookup = make(map[string]*Field, len(r.Fields))
+		r.roleType = nil
+
+		if rt, ok := nt.roleLookup[r.Name]; ok {
+			r.roleType = rt
+		} else {
+			errs = errs.add(CodeRoleUnknown, locNode(n.Name, r.Name, -1, ""), "role type not found")
+			continue
+		}
+		if _, ok := n.roleLookup[r.Name]; ok {
+			errs = errs.add(CodeRoleDuplicate, locNode(n.Name, r.Name, -1, ""), "role re-defined")
+			continue
+		}
+		n.roleLookup[r.Name] = r
+
+		// Check field count property.
+		switch r.roleType.FieldCount {
+		default:
+			errs = errs.add(CodeFieldCount, locType(nt.Name, r.roleType.Name, ""), "unknown FieldCount %v", r.roleType.FieldCount)
+		case ZeroPlus:
+			// All lengths of Fields okay.
+		case One:
+			if len(r.Fields) != 1 {
+				errs = errs.add(CodeFieldCount, locNode(n.Name, r.Name, -1, ""), "expects one field, but has %d", len(r.Fields))
 			}
-			if _, ok := n.roleLookup[r.Name]; ok {
-				errs = errs.AppendMsg("bus: node %q re-defines role %q", n.Name, r.Name)
-				continue
+		case OnePlus:
+			if len(r.Fields) == 0 {
+				errs = errs.add(CodeFieldCount, locNode(n.Name, r.Name, -1, ""), "expects one or more fields, but has zero")
 			}
-			n.roleLookup[r.Name] = r
+		}
 
-			// Check field count property.
-			switch r.roleType.FieldCount {
-			default:
-				errs = errs.AppendMsg("bus: unknown FieldCount in role type %q: %v", r.roleType.Name, r.roleType.FieldCount)
-			case ZeroPlus:
-				// All lengths of Fields okay.
-			case One:
-				if len(r.Fields) != 1 {
-					errs = errs.AppendMsg("bus: node %q role %q expects one field, but has %d", n.Name, r.Name, len(r.Fields))
-				}
-			case OnePlus:
-				if len(r.Fields) == 0 {
-					errs = errs.AppendMsg("bus: node %q role %q expects one or more fields, but has zero", n.Name, r.Name)
+		// Verify fields and aliases.
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			f.values = make(KV, len(r.roleType.Properties))
+
+			if len(f.Alias) > 0 {
+				if _, ok := n.bindAliasLookup[f.Alias]; !ok {
+					errs = errs.add(CodeBindAlias, locNode(n.Name, r.Name, fi, ""), "invalid bind alias %q", f.Alias)
+					continue
 				}
 			}
 
-			// Verify fields and aliases.
-			for fi := range r.Fields {
-				f := &r.Fields[fi]
-				f.values = make(KV, len(r.roleType.Properties))
-
-				if len(f.Alias) > 0 {
-					if _, ok := n.bindAliasLookup[f.Alias]; !ok {
-						errs = errs.AppendMsg("bus: node %q role %q field index %d invlid bind alias %q", n.Name, r.Name, fi, f.Alias)
-						continue
-					}
+			hasFieldName := false
+			for key, value := range f.KV {
+				pr, ok := r.roleType.propNameLookup[key]
+				if !ok {
+					errs = errs.add(CodeKeyUnknown, locNode(n.Name, r.Name, fi, key), "invalid key")
+					continue
 				}
-
-				hasFieldName := false
-				for key, value := range f.KV {
-					pr, ok := r.roleType.propNameLookup[key]
-					if !ok {
-						errs = errs.AppendMsg("bus: node %q role %q field index %d invalid key %q", n.Name, r.Name, fi, key)
+				// Validate node values.
+				if value, err := validValue(pr, value, findNode); err != nil {
+					errs = errs.add(CodeValueInvalid, locNode(n.Name, r.Name, fi, key), "invalid value for type %q: %v", pr.Type, err)
+					continue
+				} else if err = pr.checkConstraint(value); err != nil {
+					errs = errs.add(CodeConstraint, locNode(n.Name, r.Name, fi, key), "%v", err)
+					continue
+				} else {
+					f.values[key] = value
+				}
+				// Set FieldName.
+				if pr.FieldName {
+					if hasFieldName {
+						errs = errs.add(CodeFieldName, locNode(n.Name, r.Name, fi, key), "has more then one FieldName set to true")
 						continue
 					}
-					// Validate node values.
-					if value, err := validValue(pr.Type, value, b.Node); err != nil {
-						errs = errs.AppendMsg("bus: node %q role %q field index %d invalid value for type %q: %v", n.Name, r.Name, fi, key, err)
+					v, ok := f.values[key].(string)
+					if !ok {
+						errs = errs.add(CodeFieldName, locNode(n.Name, r.Name, fi, key), "is a FieldName, but not a text field; FieldName must be text")
 						continue
-					} else {
-						f.values[key] = value
-					}
-					// Set FieldName.
-					if pr.FieldName {
-						if hasFieldName {
-							errs = errs.AppendMsg("bus: node %q role %q field index %d has more then one FieldName set to true", n.Name, r.Name, fi)
-							continue
-						}
-						v, ok := f.values[key].(string)
-						if !ok {
-							errs = errs.AppendMsg("bus: node %q role %q field index %d is a FieldName, but not a text field; FieldName must be text", n.Name, r.Name, fi)
-							continue
-						}
-						hasFieldName = true
-						f.name = v
 					}
+					hasFieldName = true
+					f.name = v
 				}
+			}
 
-				if f.ID > 0 {
-					if _, ok := r.fieldIDLookup[f.ID]; ok {
-						errs = errs.AppendMsg("bus: node %q role %q field index %d has duplicate field ID %d", n.Name, r.Name, fi, f.ID)
-						continue
-					}
-					r.fieldIDLookup[f.ID] = f
+			if f.ID > 0 {
+				if _, ok := r.fieldIDLookup[f.ID]; ok {
+					errs = errs.add(CodeFieldIDDuplicate, locNode(n.Name, r.Name, fi, ""), "has duplicate field ID %d", f.ID)
+					continue
+				}
+				r.fieldIDLookup[f.ID] = f
+			}
+			if len(f.name) > 0 {
+				if _, ok := r.fieldNameLookup[f.name]; ok {
+					errs = errs.add(CodeFieldNameDuplicate, locNode(n.Name, r.Name, fi, ""), "has duplicate field name %q", f.name)
+					continue
+				}
+				r.fieldNameLookup[f.name] = f
+			}
+
+			for _, pr := range r.roleType.propNameLookup {
+				_, found := f.values[pr.Name]
+				if found {
+					continue
 				}
-				if len(f.name) > 0 {
-					if _, ok := r.fieldNameLookup[f.name]; ok {
-						errs = errs.AppendMsg("bus: node %q role %q field index %d has duplicate field name %q", n.Name, r.Name, fi, f.name)
+				f.values[pr.Name] = pr.defaultValue
+			}
+		}
+	}
+	// Verify Node has all Roles in Role Type.
+	for name := range nt.roleLookup {
+		if _, ok := n.roleLookup[name]; !ok {
+			errs = errs.add(CodeRoleMissing, locNode(n.Name, name, -1, ""), "missing role as defined in node type %q", n.Type)
+			continue
+		}
+	}
+	return errs
+}
+
+// checkRequired checks each field has a value for each property that is not optional.
+// Received properties bound to an external node are not checked.
+func (b *Bus) checkRequired(reported *Errors) *Errors {
+	var errs *Errors
+	for ni := range b.Nodes {
+		errs = errs.Append(checkRequiredNode(&b.Nodes[ni], reported))
+	}
+	return errs
+}
+
+// checkRequiredNode checks the required values of a single node.
+// A value with an error in reported is not reported again as missing.
+func checkRequiredNode(n *Node, reported *Errors) *Errors {
+	var errs *Errors
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			for pi := range r.roleType.Properties {
+				pr := &r.roleType.Properties[pi]
+				if pr.Optional || f.values[pr.Name] != nil {
+					continue
+				}
+				if pr.Recv && len(f.Alias) > 0 {
+					if bd := n.bindAliasLookup[f.Alias]; bd != nil && bd.node != nil && bd.node.external {
 						continue
 					}
-					r.fieldNameLookup[f.name] = f
 				}
+				loc := locNode(n.Name, r.Name, fi, pr.Name)
+				if reported.at(loc) {
+					continue
+				}
+				errs = errs.add(CodeRequired, loc, "missing required value")
+			}
+		}
+	}
+	return errs
+}
 
-				for _, pr := range r.roleType.propNameLookup {
-					_, found := f.values[pr.Name]
-					if found {
-						continue
+// nodeOrExternal returns the named node. If the node is not found,
+// a placeholder node is returned, see Node.External.
+func (b *Bus) nodeOrExternal(name string) *Node {
+	if n := b.nodeLookup[name]; n != nil {
+		return n
+	}
+	if n := b.externalLookup[name]; n != nil {
+		return n
+	}
+	n := &Node{
+		Name:     name,
+		Type:     b.externalType[name],
+		external: true,
+	}
+	// The node type is kept if it is a base of a node type in the bus.
+	n.nodeType = b.typeLookup[n.Type]
+	b.externalLookup[name] = n
+	return n
+}
+
+// relink updates all node pointers after the nodes have been re-ordered.
+// The ptrName contains the name of the node at each pointer prior to re-ordering.
+func (b *Bus) relink(ptrName map[*Node]string) {
+	for key := range b.nodeLookup {
+		delete(b.nodeLookup, key)
+	}
+	for key := range b.nodeByType {
+		delete(b.nodeByType, key)
+	}
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		b.nodeLookup[n.Name] = n
+		for _, alt := range n.NameAlt {
+			b.nodeLookup[alt] = n
+		}
+		b.nodeByType[n.Type] = append(b.nodeByType[n.Type], n)
+	}
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		for bi := range n.Binds {
+			bd := &n.Binds[bi]
+			if bd.node != nil && bd.node.external {
+				continue
+			}
+			bd.node = b.nodeLookup[bd.Name]
+		}
+		for ri := range n.Roles {
+			r := &n.Roles[ri]
+			for fi := range r.Fields {
+				f := &r.Fields[fi]
+				for key, v := range f.values {
+					if vn, ok := v.(*Node); ok && !vn.external {
+						f.values[key] = b.nodeLookup[ptrName[vn]]
 					}
-					f.values[pr.Name] = pr.defaultValue
 				}
 			}
 		}
-		// Verify Node has all Roles in Role Type.
-		for name := range nt.roleLookup {
-			if _, ok := n.roleLookup[name]; !ok {
-				errs = errs.AppendMsg("bus: node %q missing role %q as defined in role type %q", n.Name, name, n.Type)
+	}
+}
+
+// propagate fills unset Recv properties of aliased fields from the
+// matching Send properties of the bound node field.
+//
+// The bound field is found in the role of the same name on the bound node.
+// The field name to look for is the value of the current field under the key
+// of the bound role FieldName property, or the current field name if unset.
+func (b *Bus) propagate() *Errors {
+	var errs *Errors
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		errs = errs.Append(propagateNode(n))
+		errs = errs.Append(deriveNode(n))
+	}
+	return errs
+}
+
+// propagateNode fills the unset Recv properties of a single node.
+func propagateNode(n *Node) *Errors {
+	var errs *Errors
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		rt := r.roleType
+		if !rt.hasRecv() {
+			continue
+		}
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			br, bf, berrs := boundField(n, r, fi)
+			if berrs != nil {
+				errs = errs.Append(berrs)
 				continue
 			}
+			if bf == nil {
+				continue
+			}
+			bn := n.bindAliasLookup[f.Alias].node
+			brt := br.roleType
+			for pi := range rt.Properties {
+				pr := &rt.Properties[pi]
+				if !pr.Recv {
+					continue
+				}
+				if _, set := f.KV[pr.Name]; set {
+					continue
+				}
+				bpr := brt.propNameLookup[pr.Name]
+				if bpr == nil || !bpr.Send {
+					continue
+				}
+				if bpr.Type != pr.Type {
+					errs = errs.add(CodeRecvConflict, locNode(n.Name, r.Name, fi, pr.Name), "type %q conflicts with sent type %q from node %q", pr.Type, bpr.Type, bn.Name)
+					continue
+				}
+				value := bf.values[pr.Name]
+				if err := pr.checkConstraint(value); err != nil {
+					errs = errs.add(CodeConstraint, locNode(n.Name, r.Name, fi, pr.Name), "value sent from node %q: %v", bn.Name, err)
+					continue
+				}
+				f.values[pr.Name] = value
+			}
 		}
 	}
-	if errs != nil {
-		return errs
+	return errs
+}
+
+// boundField returns the field bound to the field at index fi of the role
+// through the field alias. The bound field is found in the role of the same
+// name on the bound node. The field name to look for is the value of the field
+// under the key of the bound role FieldName property, or the field name if unset.
+// If the field has no alias or the bound node is external, nil is returned.
+func boundField(n *Node, r *Role, fi int) (*Role, *Field, *Errors) {
+	var errs *Errors
+	f := &r.Fields[fi]
+	if len(f.Alias) == 0 {
+		return nil, nil, nil
 	}
-	err := tsort.Sort((*bussort)(b))
-	if err != nil {
-		return err
+	bd := n.bindAliasLookup[f.Alias]
+	if bd == nil || bd.node == nil {
+		return nil, nil, nil
 	}
-	b.setup = true
-	return nil
+	bn := bd.node
+	if bn.external {
+		return nil, nil, nil
+	}
+	br := bn.roleLookup[r.Name]
+	if br == nil {
+		return nil, nil, errs.add(CodeRecvRole, locNode(n.Name, r.Name, fi, ""), "alias %q bound node %q missing role %q", f.Alias, bn.Name, r.Name)
+	}
+	name := f.name
+	for _, bpr := range br.roleType.Properties {
+		if !bpr.FieldName {
+			continue
+		}
+		if v, ok := f.values[bpr.Name].(string); ok && len(v) > 0 {
+			name = v
+		}
+		break
+	}
+	bf := br.fieldNameLookup[name]
+	if bf == nil {
+		return nil, nil, errs.add(CodeRecvSource, locNode(n.Name, r.Name, fi, ""), "alias %q missing source field %q in node %q", f.Alias, name, bn.Name)
+	}
+	return br, bf, nil
 }
 
+// listPrefix is the type name prefix for a list of a scalar type, such as "[]text".
+const listPrefix = "[]"
+
 // validType checks that the type name is a valid type.
+// A list may contain any type other then a node or another list.
 // Keep in sync with validValue.
 func validType(tp string) bool {
+	if strings.HasPrefix(tp, listPrefix) {
+		et := tp[len(listPrefix):]
+		switch {
+		case strings.HasPrefix(et, listPrefix), et == "node":
+			return false
+		}
+		return validType(et)
+	}
 	switch tp {
 	default:
 		return false
@@ -287,15 +594,59 @@ func validType(tp string) bool {
 	case "decimal": // *apd.Decimal
 	case "bytes": // []byte
 	case "node": // *Node
+	case "date": // Date
+	case "timestamp": // time.Time
+	case "uuid": // UUID
+	case "json": // json.RawMessage
+	case "enum": // string
 	}
 	return true
 }
 
-// validValue takes the type name and value, and verifies it is a valid type and returns
+// validValue verifies the value is valid for the property and returns the normalized value.
+// List values are normalized to a []interface{} of the element type and enum values must be
+// one of the property Enum values.
+func validValue(pr *Property, v interface{}, findNode func(name string) *Node) (interface{}, error) {
+	if strings.HasPrefix(pr.Type, listPrefix) {
+		et := pr.Type[len(listPrefix):]
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected %[1]s got %[2]T (%[2]v)", pr.Type, v)
+		}
+		ret := make([]interface{}, len(list))
+		for i, item := range list {
+			value, err := validElem(et, pr.Enum, item, findNode)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			ret[i] = value
+		}
+		return ret, nil
+	}
+	return validElem(pr.Type, pr.Enum, v, findNode)
+}
+
+func validElem(tp string, enum []string, v interface{}, findNode func(name string) *Node) (interface{}, error) {
+	if tp != "enum" {
+		return validScalar(tp, v, findNode)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected %[1]s got %[2]T (%[2]v)", tp, v)
+	}
+	for _, e := range enum {
+		if s == e {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("%s value %q must be one of %q", tp, s, enum)
+}
+
+// validScalar takes the type name and value, and verifies it is a valid type and returns
 // a normalized value. For example a type with "int" and a string value of "123" will return
 // an int64 value of 123.
 // Keep in sync with validType.
-func validValue(tp string, v interface{}, findNode func(name string) *Node) (interface{}, error) {
+func validScalar(tp string, v interface{}, findNode func(name string) *Node) (interface{}, error) {
 	switch tp {
 	default:
 		return nil, fmt.Errorf("unknown type %s", tp)
@@ -414,6 +765,8 @@ func validValue(tp string, v interface{}, findNode func(name string) *Node) (int
 				return nil, err
 			}
 			return dec, nil
+		case *apd.Decimal:
+			return v, nil
 		}
 	case "bytes":
 		switch v := v.(type) {
@@ -441,6 +794,8 @@ func validValue(tp string, v interface{}, findNode func(name string) *Node) (int
 				bb, err := base64.StdEncoding.DecodeString(bytea)
 				return bb, err
 			}
+		case []byte:
+			return v, nil
 		}
 	case "node":
 		s, ok := v.(string)
@@ -452,5 +807,52 @@ func validValue(tp string, v interface{}, findNode func(name string) *Node) (int
 			return nil, fmt.Errorf("%s %s is not a valid node name", tp, v)
 		}
 		return nd, nil
+	case "date":
+		switch v := v.(type) {
+		default:
+			return nil, fmt.Errorf("expected %[1]s got %[2]T (%[2]v)", tp, v)
+		case Date:
+			return v, nil
+		case string:
+			return ParseDate(v)
+		}
+	case "timestamp":
+		switch v := v.(type) {
+		default:
+			return nil, fmt.Errorf("expected %[1]s got %[2]T (%[2]v)", tp, v)
+		case time.Time:
+			return v.UTC().Round(0), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, err
+			}
+			return t.UTC(), nil
+		}
+	case "uuid":
+		switch v := v.(type) {
+		default:
+			return nil, fmt.Errorf("expected %[1]s got %[2]T (%[2]v)", tp, v)
+		case UUID:
+			return v, nil
+		case string:
+			return ParseUUID(v)
+		}
+	case "json":
+		// A string is JSON text, any other value is encoded as JSON.
+		var raw []byte
+		switch v := v.(type) {
+		default:
+			bb, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", tp, err)
+			}
+			raw = bb
+		case json.RawMessage:
+			raw = v
+		case string:
+			raw = []byte(v)
+		}
+		return normalizeJSON(raw)
 	}
 }
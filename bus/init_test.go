@@ -1,10 +1,15 @@
 package bus_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
+	"solidcoredata.org/src/databus/bus"
 	"solidcoredata.org/src/databus/bus/load"
 
 	"github.com/google/go-jsonnet"
@@ -72,6 +77,462 @@ func TestVerify(t *testing.T) {
 	}
 }
 
+func TestSendRecv(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/test/table",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true, Send: true},
+                        {Name: "type", Type: "text", Send: true},
+                        {Name: "length", Type: "int", Default: 0, Send: true},
+                    ],
+                },
+            ],
+        },
+        {
+            Name: "solidcoredata.org/test/ui",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", Recv: true},
+                        {Name: "type", Type: "text", Recv: true},
+                        {Name: "length", Type: "int", Optional: true, Recv: true},
+                    ],
+                },
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "ui",
+            Type: "solidcoredata.org/test/ui",
+            Roles: [
+                {
+                    Name: "schema",
+                    Fields: [
+                        {Alias: "b", KV: {name: "title"}},
+                        {Alias: "b", KV: {name: "pages", type: "count"}},
+                    ],
+                },
+            ],
+            Binds: [
+                {Alias: "b", Name: "book"},
+            ],
+        },
+        {
+            Name: "book",
+            Type: "solidcoredata.org/test/table",
+            Roles: [
+                {
+                    Name: "schema",
+                    Fields: [
+                        {KV: {name: "title", type: "text", length: 1000}},
+                        {KV: {name: "pages", type: "int"}},
+                    ],
+                },
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	err = b.Init()
+	if err != nil {
+		t.Fatal("validate", err)
+	}
+	ui := b.Node("ui")
+	if ui == nil || ui.Name != "ui" {
+		t.Fatalf("invalid node lookup after sort: %v", ui)
+	}
+	if got := ui.BindAlias("b").Node().Name; got != "book" {
+		t.Fatalf("invalid bound node, got %q", got)
+	}
+	list := []struct {
+		Field int
+		Key   string
+		Want  interface{}
+	}{
+		{0, "type", "text"},
+		{0, "length", int64(1000)},
+		{1, "type", "count"},
+		{1, "length", int64(0)},
+	}
+	sch := ui.Role("schema")
+	for _, item := range list {
+		got := sch.Fields[item.Field].Value(item.Key)
+		if got != item.Want {
+			t.Errorf("field %d %q: got %v want %v", item.Field, item.Key, got, item.Want)
+		}
+	}
+}
+
+func TestRecvConstraint(t *testing.T) {
+	max := 100.0
+	b := &bus.Bus{
+		Types: []bus.NodeType{
+			{
+				Name: "solidcoredata.org/test/table",
+				Roles: []bus.RoleType{{Name: "schema", Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true, Send: true},
+					{Name: "length", Type: "int", Default: 0, Send: true},
+				}}},
+			},
+			{
+				Name: "solidcoredata.org/test/ui",
+				Roles: []bus.RoleType{{Name: "schema", Properties: []bus.Property{
+					{Name: "name", Type: "text", Recv: true},
+					{Name: "length", Type: "int", Optional: true, Recv: true, Max: &max},
+				}}},
+			},
+		},
+		Nodes: []bus.Node{
+			{
+				Name:  "ui",
+				Type:  "solidcoredata.org/test/ui",
+				Binds: []bus.Bind{{Alias: "b", Name: "book"}},
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+					{Alias: "b", KV: bus.KV{"name": "title"}},
+					{Alias: "b", KV: bus.KV{"name": "pages"}},
+				}}},
+			},
+			{
+				Name: "book",
+				Type: "solidcoredata.org/test/table",
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+					{KV: bus.KV{"name": "title", "length": 1000}},
+					{KV: bus.KV{"name": "pages", "length": 10}},
+				}}},
+			},
+		},
+	}
+	err := b.Init()
+	var errs *bus.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected errors, got %v", err)
+	}
+	if len(errs.List) != 1 {
+		t.Fatalf("expected 1 error, got %v", err)
+	}
+	d := errs.List[0]
+	if d.Code != bus.CodeConstraint || d.Node != "ui" || d.Field != 0 || d.Property != "length" {
+		t.Fatalf("expected constraint error on ui field 0 length, got %v", d)
+	}
+}
+
+func TestDiagnostic(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true},
+                        {Name: "count", Type: "int"},
+                    ],
+                },
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "node1",
+            Type: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Fields: [
+                        {KV: {name: "a", count: 1}},
+                        {KV: {name: "b", count: "many"}},
+                    ],
+                },
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	err = b.Init()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !errors.Is(err, bus.CodeValueInvalid) {
+		t.Fatalf("expected %q, got %v", bus.CodeValueInvalid, err)
+	}
+	if errors.Is(err, bus.CodeNodeDuplicate) {
+		t.Fatalf("unexpected %q, got %v", bus.CodeNodeDuplicate, err)
+	}
+	var d *bus.Diagnostic
+	if !errors.As(err, &d) {
+		t.Fatalf("expected diagnostic, got %T", err)
+	}
+	want := bus.Location{Node: "node1", Role: "p1", Field: 1, Property: "count"}
+	if d.Location != want {
+		t.Fatalf("got location %#v want %#v", d.Location, want)
+	}
+	if d.Severity != bus.SeverityError {
+		t.Fatalf("got severity %v", d.Severity)
+	}
+}
+
+func TestTypes(t *testing.T) {
+	const types = `
+    Types: [
+        {
+            Name: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true},
+                        {Name: "born", Type: "date"},
+                        {Name: "updated", Type: "timestamp"},
+                        {Name: "id", Type: "uuid"},
+                        {Name: "extra", Type: "json", Default: "{}"},
+                        {Name: "color", Type: "enum", Enum: ["red", "blue"], Default: "red"},
+                        {Name: "tags", Type: "[]text", Optional: true},
+                        {Name: "sizes", Type: "[]int", Optional: true},
+                    ],
+                },
+            ],
+        },
+    ],
+`
+	var input = `
+{
+` + types + `
+    Nodes: [
+        {
+            Name: "node1",
+            Type: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Fields: [
+                        {KV: {
+                            name: "a",
+                            born: "2020-02-29",
+                            updated: "2020-02-29T10:00:00-05:00",
+                            id: "F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6",
+                            extra: {b: [1, 2], a: "x"},
+                            color: "blue",
+                            tags: ["one", "two"],
+                            sizes: [1, "2"],
+                        }},
+                    ],
+                },
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	load1 := func() *bus.Bus {
+		b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+		if err != nil {
+			t.Fatal("load", err)
+		}
+		if err = b.Init(); err != nil {
+			t.Fatal("validate", err)
+		}
+		return b
+	}
+	b := load1()
+	f := b.Node("node1").Role("p1").Fields[0]
+	list := []struct {
+		Key  string
+		Want string
+	}{
+		{"born", "2020-02-29"},
+		{"updated", "2020-02-29 15:00:00 +0000 UTC"},
+		{"id", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6"},
+		{"extra", `{"a":"x","b":[1,2]}`},
+		{"color", "blue"},
+		{"tags", "[one two]"},
+		{"sizes", "[1 2]"},
+	}
+	for _, item := range list {
+		var got string
+		switch v := f.Value(item.Key).(type) {
+		case []byte:
+			got = string(v)
+		case json.RawMessage:
+			got = string(v)
+		default:
+			got = fmt.Sprint(v)
+		}
+		if got != item.Want {
+			t.Errorf("%s: got %s want %s", item.Key, got, item.Want)
+		}
+	}
+
+	delta, err := bus.NewDelta(load1(), b)
+	if err != nil {
+		t.Fatal("delta", err)
+	}
+	if len(delta.Actions) != 0 {
+		t.Fatalf("expected no changes, got %d", len(delta.Actions))
+	}
+
+	out, err := b.MarshalCanonical()
+	if err != nil {
+		t.Fatal("encode", err)
+	}
+	b2, err := bus.DecodeCanonical(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal("decode", err)
+	}
+	delta, err = bus.NewDelta(b2, b)
+	if err != nil {
+		t.Fatal("delta", err)
+	}
+	if len(delta.Actions) != 0 {
+		t.Fatalf("expected no changes after round trip, got %d", len(delta.Actions))
+	}
+
+	invalid := `
+{
+` + types + `
+    Nodes: [
+        {
+            Name: "node1",
+            Type: "solidcoredata.org/test",
+            Roles: [
+                {
+                    Name: "p1",
+                    Fields: [
+                        {KV: {name: "a", born: "2020-02-30", updated: "now", id: "x", color: "green", sizes: ["a"]}},
+                    ],
+                },
+            ],
+        },
+    ],
+}
+    `
+	b, err = load.BusReader(ctx, strings.NewReader(throughJsonnet(t, invalid)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	err = b.Init()
+	var errs *bus.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected errors, got %v", err)
+	}
+	if len(errs.List) != 5 {
+		t.Fatalf("expected 5 errors, got %v", err)
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	const types = `
+    Types: [
+        {
+            Name: "solidcoredata.org/test/db",
+            Roles: [{Name: "prop", Properties: [{Name: "name", Type: "text"}]}],
+        },
+        {
+            Name: "solidcoredata.org/test/table",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true, Pattern: "^[a-z_]+$", MaxLength: 10},
+                        {Name: "size", Type: "int", Optional: true, Min: 1, Max: 100},
+                        {Name: "tags", Type: "[]text", Optional: true, MaxLength: 2, Pattern: "^#"},
+                        {Name: "fk", Type: "node", Optional: true, NodeTypes: ["solidcoredata.org/test/table"]},
+                    ],
+                },
+            ],
+        },
+    ],
+`
+	list := []struct {
+		Name   string
+		Fields string
+		Codes  []bus.Code
+	}{
+		{
+			Name:   "valid",
+			Fields: `{KV: {name: "a", size: 1, tags: ["#a"], fk: "t1"}}`,
+		},
+		{
+			Name: "constraint",
+			Fields: `
+                {KV: {name: "Abc"}},
+                {KV: {name: "abcdefghijk"}},
+                {KV: {name: "a", size: 0}},
+                {KV: {name: "b", size: 101}},
+                {KV: {name: "c", tags: ["#a", "#b", "#c"]}},
+                {KV: {name: "d", tags: ["a"]}},
+                {KV: {name: "e", fk: "db"}},
+            `,
+			Codes: []bus.Code{bus.CodeConstraint, bus.CodeConstraint, bus.CodeConstraint, bus.CodeConstraint, bus.CodeConstraint, bus.CodeConstraint, bus.CodeConstraint},
+		},
+		{
+			Name:   "required",
+			Fields: `{KV: {size: 5}}`,
+			Codes:  []bus.Code{bus.CodeRequired},
+		},
+	}
+	ctx := context.Background()
+	for _, item := range list {
+		t.Run(item.Name, func(t *testing.T) {
+			input := `
+{
+` + types + `
+    Nodes: [
+        {Name: "db", Type: "solidcoredata.org/test/db", Roles: [{Name: "prop", Fields: [{KV: {name: "db"}}]}]},
+        {Name: "t1", Type: "solidcoredata.org/test/table", Roles: [{Name: "schema", Fields: [{KV: {name: "id"}}]}]},
+        {Name: "t2", Type: "solidcoredata.org/test/table", Roles: [{Name: "schema", Fields: [` + item.Fields + `]}]},
+    ],
+}
+`
+			b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+			if err != nil {
+				t.Fatal("load", err)
+			}
+			err = b.Init()
+			if len(item.Codes) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var errs *bus.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected errors, got %v", err)
+			}
+			if len(errs.List) != len(item.Codes) {
+				t.Fatalf("expected %d errors, got %v", len(item.Codes), err)
+			}
+			for i, d := range errs.List {
+				if d.Code != item.Codes[i] {
+					t.Errorf("index %d: got code %q want %q", i, d.Code, item.Codes[i])
+				}
+			}
+		})
+	}
+}
+
 // throughJsonnet is used to allow trailing commas in input, and
 // allow most keys to be un-quoted. It also gives really good error messages.
 func throughJsonnet(t *testing.T, s string) string {
@@ -0,0 +1,243 @@
+package bus
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// LintRule checks a bus for a convention that is not required by Init.
+type LintRule struct {
+	Name     string   // Unique name of the rule, such as "role-key".
+	Usage    string   // Description of the convention.
+	Severity Severity // Default severity of each reported Diagnostic.
+	Check    func(b *Bus, r *LintReport)
+}
+
+// LintCode returns the Diagnostic Code of the lint rule name.
+func LintCode(name string) Code {
+	return Code("lint/" + name)
+}
+
+// LintReport collects the Diagnostics reported by a single lint rule.
+type LintReport struct {
+	code     Code
+	severity Severity
+	errs     *Errors
+
+	scoped bool
+	scope  []Match // Selected by the configured selector if scoped.
+}
+
+// Report a Diagnostic at the location. If the rule is scoped by a selector,
+// a Diagnostic outside of the selection is dropped.
+func (r *LintReport) Report(loc Location, f string, v ...interface{}) {
+	if r.scoped && !r.inScope(loc) {
+		return
+	}
+	r.errs = r.errs.addSeverity(r.severity, r.code, loc, f, v...)
+}
+
+// inScope reports if the location overlaps a selected node, role, or field.
+// A location without a node is compared to the node type of each selected node.
+func (r *LintReport) inScope(loc Location) bool {
+	for _, m := range r.scope {
+		if len(loc.Node) == 0 {
+			if len(loc.NodeType) > 0 && m.Node.IsA(loc.NodeType) {
+				return true
+			}
+			continue
+		}
+		if m.Node.Name != loc.Node {
+			continue
+		}
+		if m.Role != nil && len(loc.Role) > 0 && m.Role.Name != loc.Role {
+			continue
+		}
+		if m.Field != nil && loc.Field >= 0 && m.FieldIndex != loc.Field {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// LintConfig configures the lint rules to run.
+type LintConfig struct {
+	// Rules sets the severity of each named rule to "error", "warning",
+	// "info", or "off". Rules not listed run with the default severity.
+	Rules map[string]string
+
+	// Select limits each named rule to the nodes, roles, or fields selected
+	// by a selector, see Selector. Rules not listed check the whole bus.
+	Select map[string]string
+}
+
+// Linter runs lint rules on a bus.
+type Linter struct {
+	rules  []LintRule
+	lookup map[string]bool
+}
+
+// NewLinter returns a Linter with the built-in lint rules, see LintRules.
+func NewLinter() *Linter {
+	l := &Linter{lookup: make(map[string]bool)}
+	if err := l.Add(LintRules()...); err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// Add rules to the linter, such as rules provided by an extension.
+func (l *Linter) Add(rules ...LintRule) error {
+	for _, r := range rules {
+		if len(r.Name) == 0 || r.Check == nil {
+			return fmt.Errorf("bus: lint rule %q requires a Name and Check", r.Name)
+		}
+		if l.lookup[r.Name] {
+			return fmt.Errorf("bus: lint rule %q already added", r.Name)
+		}
+		l.lookup[r.Name] = true
+		l.rules = append(l.rules, r)
+	}
+	return nil
+}
+
+// Rules returns the rules of the linter, ordered by name.
+func (l *Linter) Rules() []LintRule {
+	ret := append([]LintRule(nil), l.rules...)
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Lint the initialized bus with the configured rules. The returned Diagnostics
+// are ordered by rule name. An error is returned if the configuration is not valid.
+func (l *Linter) Lint(b *Bus, config LintConfig) (*Errors, error) {
+	if !b.setup {
+		return nil, fmt.Errorf("bus: lint on a bus that is not initialized")
+	}
+	severity := make(map[string]Severity, len(l.rules))
+	off := make(map[string]bool)
+	for name, value := range config.Rules {
+		if !l.lookup[name] {
+			return nil, fmt.Errorf("bus: lint config unknown rule %q", name)
+		}
+		if value == "off" {
+			off[name] = true
+			continue
+		}
+		var s Severity
+		if err := s.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("bus: lint config rule %q: %w", name, err)
+		}
+		severity[name] = s
+	}
+	scope := make(map[string][]Match, len(config.Select))
+	for name, text := range config.Select {
+		if !l.lookup[name] {
+			return nil, fmt.Errorf("bus: lint config select unknown rule %q", name)
+		}
+		list, err := b.Select(text)
+		if err != nil {
+			return nil, fmt.Errorf("bus: lint config rule %q: %w", name, err)
+		}
+		scope[name] = list
+	}
+	var errs *Errors
+	for _, rule := range l.Rules() {
+		if off[rule.Name] {
+			continue
+		}
+		s, ok := severity[rule.Name]
+		if !ok {
+			s = rule.Severity
+		}
+		r := &LintReport{code: LintCode(rule.Name), severity: s}
+		r.scope, r.scoped = scope[rule.Name]
+		rule.Check(b, r)
+		errs = errs.Append(r.errs)
+	}
+	return errs, nil
+}
+
+// LintRules returns the built-in lint rules.
+func LintRules() []LintRule {
+	return []LintRule{
+		{
+			Name:     "field-snake-case",
+			Usage:    "Field names are lower case words separated by underscores.",
+			Severity: SeverityWarning,
+			Check:    lintFieldSnakeCase,
+		},
+		{
+			Name:     "node-unreferenced",
+			Usage:    "Each node refers to or is referred to by another node.",
+			Severity: SeverityWarning,
+			Check:    lintNodeUnreferenced,
+		},
+		{
+			Name:     "role-key",
+			Usage:    "Each role with a bool \"key\" property has at least one key field.",
+			Severity: SeverityWarning,
+			Check:    lintRoleKey,
+		},
+	}
+}
+
+var snakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+func lintFieldSnakeCase(b *Bus, r *LintReport) {
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		for _, role := range n.Roles {
+			for fi, f := range role.Fields {
+				if len(f.name) == 0 || snakeCase.MatchString(f.name) {
+					continue
+				}
+				r.Report(locNode(n.Name, role.Name, fi, ""), "field name %q is not snake case", f.name)
+			}
+		}
+	}
+}
+
+func lintNodeUnreferenced(b *Bus, r *LintReport) {
+	referenced := make(map[string]bool, len(b.Nodes))
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		refs := n.ToNode()
+		if len(refs) > 0 {
+			referenced[n.Name] = true
+		}
+		for _, name := range refs {
+			referenced[name] = true
+		}
+	}
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		if !referenced[n.Name] {
+			r.Report(locNode(n.Name, "", -1, ""), "node does not refer to and is not referred to by any node")
+		}
+	}
+}
+
+func lintRoleKey(b *Bus, r *LintReport) {
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		for _, role := range n.Roles {
+			pr := role.roleType.propNameLookup["key"]
+			if pr == nil || pr.Type != "bool" {
+				continue
+			}
+			hasKey := false
+			for _, f := range role.Fields {
+				if key, _ := f.values["key"].(bool); key {
+					hasKey = true
+					break
+				}
+			}
+			if !hasKey && len(role.Fields) > 0 {
+				r.Report(locNode(n.Name, role.Name, -1, ""), "no field is a key")
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package bus_test
+
+import (
+	"errors"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestLint(t *testing.T) {
+	b := &bus.Bus{
+		Types: []bus.NodeType{
+			{
+				Name: "solidcoredata.org/test/table",
+				Roles: []bus.RoleType{
+					{
+						Name: "schema",
+						Properties: []bus.Property{
+							{Name: "name", Type: "text", FieldName: true},
+							{Name: "key", Type: "bool", Optional: true, Default: false},
+							{Name: "fk", Type: "node", Optional: true},
+						},
+					},
+				},
+			},
+		},
+		Nodes: []bus.Node{
+			{
+				Name: "author",
+				Type: "solidcoredata.org/test/table",
+				Meta: bus.Meta{Description: "Author of a book."},
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+					{KV: bus.KV{"name": "id", "key": true}},
+				}}},
+			},
+			{
+				Name: "book",
+				Type: "solidcoredata.org/test/table",
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+					{KV: bus.KV{"name": "id"}},
+					{KV: bus.KV{"name": "AuthorID", "fk": "author"}},
+				}}},
+			},
+			{
+				Name: "lonely",
+				Type: "solidcoredata.org/test/table",
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{
+					{KV: bus.KV{"name": "id", "key": true}},
+				}}},
+			},
+		},
+	}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	type finding struct {
+		Code     bus.Code
+		Severity bus.Severity
+		Node     string
+		Field    int
+	}
+	list := []struct {
+		Name   string
+		Config bus.LintConfig
+		Want   []finding
+	}{
+		{
+			Name: "default",
+			Want: []finding{
+				{bus.LintCode("field-snake-case"), bus.SeverityWarning, "book", 1},
+				{bus.LintCode("node-unreferenced"), bus.SeverityWarning, "lonely", -1},
+				{bus.LintCode("role-key"), bus.SeverityWarning, "book", -1},
+			},
+		},
+		{
+			Name: "configured",
+			Config: bus.LintConfig{Rules: map[string]string{
+				"field-snake-case":  "off",
+				"node-unreferenced": "info",
+				"role-key":          "error",
+			}},
+			Want: []finding{
+				{bus.LintCode("node-unreferenced"), bus.SeverityInfo, "lonely", -1},
+				{bus.LintCode("role-key"), bus.SeverityError, "book", -1},
+			},
+		},
+		{
+			Name: "selected",
+			Config: bus.LintConfig{Select: map[string]string{
+				"field-snake-case":  "*/schema[key=true]",
+				"node-unreferenced": "name=lonely",
+				"role-key":          "type=solidcoredata.org/test/table/schema[fk]",
+			}},
+			Want: []finding{
+				{bus.LintCode("node-unreferenced"), bus.SeverityWarning, "lonely", -1},
+				{bus.LintCode("role-key"), bus.SeverityWarning, "book", -1},
+			},
+		},
+	}
+	// Findings of each rule are in node order.
+	l := bus.NewLinter()
+	for _, item := range list {
+		t.Run(item.Name, func(t *testing.T) {
+			errs, err := l.Lint(b, item.Config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(errs.List) != len(item.Want) {
+				t.Fatalf("expected %d findings, got %v", len(item.Want), errs)
+			}
+			for i, d := range errs.List {
+				got := finding{d.Code, d.Severity, d.Node, d.Field}
+				if got != item.Want[i] {
+					t.Errorf("finding %d: expected %v, got %v", i, item.Want[i], got)
+				}
+			}
+		})
+	}
+
+	if _, err := l.Lint(b, bus.LintConfig{Rules: map[string]string{"missing": "error"}}); err == nil {
+		t.Fatal("expected error for unknown rule")
+	}
+	if _, err := l.Lint(b, bus.LintConfig{Rules: map[string]string{"role-key": "loud"}}); err == nil {
+		t.Fatal("expected error for unknown severity")
+	}
+	if _, err := l.Lint(b, bus.LintConfig{Select: map[string]string{"missing": "*"}}); err == nil {
+		t.Fatal("expected error for unknown selected rule")
+	}
+	if _, err := l.Lint(b, bus.LintConfig{Select: map[string]string{"role-key": "other"}}); err == nil {
+		t.Fatal("expected error for invalid selector")
+	}
+
+	// Rules from an extension.
+	custom := bus.LintRule{
+		Name:     "no-books",
+		Severity: bus.SeverityError,
+		Check: func(b *bus.Bus, r *bus.LintReport) {
+			if n := b.Node("book"); n != nil {
+				r.Report(bus.Location{Node: n.Name, Field: -1}, "books are not allowed")
+			}
+		},
+	}
+	if err := l.Add(custom); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Add(custom); err == nil {
+		t.Fatal("expected error adding duplicate rule")
+	}
+	errs, err := l.Lint(b, bus.LintConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errs.HasError() || !errors.Is(errs, bus.LintCode("no-books")) {
+		t.Fatalf("expected no-books error, got %v", errs)
+	}
+}
@@ -0,0 +1,230 @@
+package bus
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Fragment is part of a bus defined in a single package.
+type Fragment struct {
+	// Package is the name prefix of every node in the fragment, such as
+	// "app1.coredata.biz/n/db". Node names within the fragment are relative
+	// to the package. If empty, node names are used as is.
+	Package string
+
+	Bus *Bus
+}
+
+// Merge fragments into a single bus.
+//
+// Node types of the same name must be identical in every fragment.
+// Each node name and alternate name is prefixed with the fragment package.
+// Bind and node value references are first resolved within the fragment
+// package, then as full node names from any fragment.
+// The package of each node is recorded in Node.Package.
+//
+// The merged bus is initialized before it is returned.
+func Merge(frags ...Fragment) (*Bus, error) {
+	var errs *Errors
+	m := &Bus{}
+
+	typeIndex := make(map[string]int)
+	typePackage := make(map[string]string)
+	for _, fr := range frags {
+		if fr.Bus == nil {
+			continue
+		}
+		for _, nt := range fr.Bus.Types {
+			if i, ok := typeIndex[nt.Name]; ok {
+				if !typeEqual(m.Types[i], nt) {
+					errs = errs.add(CodeMergeType, locType(nt.Name, "", ""), "package %q defines node type differently then package %q", fr.Package, typePackage[nt.Name])
+				}
+				continue
+			}
+			typeIndex[nt.Name] = len(m.Types)
+			typePackage[nt.Name] = fr.Package
+			m.Types = append(m.Types, nt.copy(nil))
+		}
+	}
+
+	// propType by node type, role, and property name. Roles inherited
+	// through Extends are searched as well, an override keeps the type.
+	var propType func(nodeType, role, prop string, visited map[string]bool) string
+	propType = func(nodeType, role, prop string, visited map[string]bool) string {
+		i, ok := typeIndex[nodeType]
+		if !ok || visited[nodeType] {
+			return ""
+		}
+		visited[nodeType] = true
+		nt := &m.Types[i]
+		for _, rt := range nt.Roles {
+			if rt.Name != role {
+				continue
+			}
+			for _, pr := range rt.Properties {
+				if pr.Name == prop {
+					return pr.Type
+				}
+			}
+		}
+		for _, base := range nt.Extends {
+			if t := propType(base, role, prop, visited); len(t) > 0 {
+				return t
+			}
+		}
+		return ""
+	}
+
+	full := make(map[string]string) // Full node name to package.
+	for _, fr := range frags {
+		if fr.Bus == nil {
+			continue
+		}
+		for _, n := range fr.Bus.Nodes {
+			names := append([]string{n.Name}, n.NameAlt...)
+			for _, name := range names {
+				fn := qualify(fr.Package, name)
+				if pkg, ok := full[fn]; ok {
+					errs = errs.add(CodeNodeDuplicate, locNode(fn, "", -1, ""), "node defined in package %q and package %q", pkg, fr.Package)
+					continue
+				}
+				full[fn] = fr.Package
+			}
+		}
+	}
+	resolve := func(pkg, name string) (string, bool) {
+		local := qualify(pkg, name)
+		if _, ok := full[local]; ok {
+			return local, true
+		}
+		if _, ok := full[name]; ok {
+			return name, true
+		}
+		return name, false
+	}
+
+	for _, fr := range frags {
+		if fr.Bus == nil {
+			continue
+		}
+		for _, n := range fr.Bus.Nodes {
+			c := n.copy(nil)
+			c.Name = qualify(fr.Package, n.Name)
+			c.Package = fr.Package
+			if len(n.NameAlt) > 0 {
+				c.NameAlt = make([]string, len(n.NameAlt))
+				for i, alt := range n.NameAlt {
+					c.NameAlt[i] = qualify(fr.Package, alt)
+				}
+			}
+			for bi := range c.Binds {
+				bd := &c.Binds[bi]
+				name, ok := resolve(fr.Package, bd.Name)
+				if !ok {
+					errs = errs.add(CodeBindNode, locNode(c.Name, "", -1, ""), "bind alias %q invalid node name %q in package %q", bd.Alias, bd.Name, fr.Package)
+					continue
+				}
+				bd.Name = name
+			}
+			for ri := range c.Roles {
+				r := &c.Roles[ri]
+				for fi := range r.Fields {
+					f := &r.Fields[fi]
+					var kv KV
+					for key, v := range f.KV {
+						ref, isText := v.(string)
+						if !isText || propType(c.Type, r.Name, key, make(map[string]bool)) != "node" {
+							continue
+						}
+						name, ok := resolve(fr.Package, ref)
+						if !ok {
+							errs = errs.add(CodeValueInvalid, locNode(c.Name, r.Name, fi, key), "node %q not found in package %q", ref, fr.Package)
+							continue
+						}
+						if kv == nil {
+							kv = make(KV, len(f.KV))
+							for k, v := range f.KV {
+								kv[k] = v
+							}
+						}
+						kv[key] = name
+					}
+					if kv != nil {
+						f.KV = kv
+					}
+				}
+			}
+			m.Nodes = append(m.Nodes, c)
+		}
+	}
+	for _, fr := range frags {
+		if fr.Bus == nil {
+			continue
+		}
+		for _, sc := range fr.Bus.Scripts {
+			if len(sc.Name) > 0 {
+				sc.Name = qualify(fr.Package, sc.Name)
+			}
+			m.Scripts = append(m.Scripts, sc)
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return m, m.Init()
+}
+
+// qualify the node name with the package name.
+func qualify(pkg, name string) string {
+	if len(pkg) == 0 {
+		return name
+	}
+	return strings.TrimSuffix(pkg, "/") + "/" + name
+}
+
+// typeEqual reports if two node type definitions are the same.
+func typeEqual(a, b NodeType) bool {
+	if a.Name != b.Name || a.Version != b.Version || len(a.Extends) != len(b.Extends) || len(a.Roles) != len(b.Roles) {
+		return false
+	}
+	for i := range a.Extends {
+		if a.Extends[i] != b.Extends[i] {
+			return false
+		}
+	}
+	for i := range a.Roles {
+		ra, rb := a.Roles[i], b.Roles[i]
+		if ra.Name != rb.Name || ra.Side != rb.Side || ra.FieldCount != rb.FieldCount || len(ra.Properties) != len(rb.Properties) {
+			return false
+		}
+		for pi := range ra.Properties {
+			pa, pb := ra.Properties[pi], rb.Properties[pi]
+			if !defaultEqual(&pa, &pb) {
+				return false
+			}
+			pa.Default, pb.Default = nil, nil
+			pa.defaultValue, pb.defaultValue = nil, nil
+			pa.pattern, pb.pattern = nil, nil
+			pa.expr, pb.expr = nil, nil
+			if !reflect.DeepEqual(pa, pb) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// defaultEqual reports if both properties have the same normalized default,
+// so a default decoded from cue and from JSON compare equal.
+func defaultEqual(a, b *Property) bool {
+	if a.Default == nil || b.Default == nil {
+		return a.Default == nil && b.Default == nil
+	}
+	noNode := func(name string) *Node { return nil }
+	va, errA := validValue(a, a.Default, noNode)
+	vb, errB := validValue(b, b.Default, noNode)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a.Default, b.Default)
+	}
+	return valueEqual(va, vb)
+}
@@ -0,0 +1,174 @@
+package bus_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestMerge(t *testing.T) {
+	table := bus.NodeType{
+		Name: "solidcoredata.org/test/table",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "fk", Type: "node", Optional: true},
+				},
+			},
+		},
+	}
+	ui := bus.NodeType{
+		Name: "solidcoredata.org/test/ui",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text"},
+				},
+			},
+		},
+	}
+	db := &bus.Bus{
+		Types: []bus.NodeType{table},
+		Nodes: []bus.Node{
+			{
+				Name:  "genre",
+				Type:  table.Name,
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: bus.KV{"name": "id"}}}}},
+			},
+			{
+				Name:  "book",
+				Type:  table.Name,
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: bus.KV{"name": "genre", "fk": "genre"}}}}},
+			},
+		},
+	}
+	screens := &bus.Bus{
+		Types: []bus.NodeType{table, ui},
+		Nodes: []bus.Node{
+			{
+				Name:  "book",
+				Type:  ui.Name,
+				Binds: []bus.Bind{{Alias: "b", Name: "example.com/db/book"}},
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{Alias: "b", KV: bus.KV{"name": "genre"}}}}},
+			},
+		},
+	}
+
+	b, err := bus.Merge(
+		bus.Fragment{Package: "example.com/db", Bus: db},
+		bus.Fragment{Package: "example.com/ui", Bus: screens},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := len(b.Types); g != 2 {
+		t.Fatalf("got %d types, want 2", g)
+	}
+	book := b.Node("example.com/db/book")
+	if book == nil {
+		t.Fatal("missing example.com/db/book")
+	}
+	if g, w := book.Package, "example.com/db"; g != w {
+		t.Fatalf("got package %q, want %q", g, w)
+	}
+	fk, ok := book.Role("schema").Fields[0].Value("fk").(*bus.Node)
+	if !ok || fk.Name != "example.com/db/genre" {
+		t.Fatalf("fk not resolved within package: %v", fk)
+	}
+	uiBook := b.Node("example.com/ui/book")
+	if uiBook == nil {
+		t.Fatal("missing example.com/ui/book")
+	}
+	if g, w := uiBook.Binds[0].Node().Name, "example.com/db/book"; g != w {
+		t.Fatalf("got bind %q, want %q", g, w)
+	}
+
+	// The source buses are not changed.
+	if g := db.Nodes[1].Name; g != "book" {
+		t.Fatalf("source node renamed to %q", g)
+	}
+
+	// Node values in inherited roles are resolved within the package.
+	view := bus.NodeType{Name: "solidcoredata.org/test/view", Extends: []string{table.Name}}
+	views := &bus.Bus{
+		Types: []bus.NodeType{table, view},
+		Nodes: []bus.Node{
+			{
+				Name:  "book_view",
+				Type:  view.Name,
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: bus.KV{"name": "genre", "fk": "genre"}}}}},
+			},
+		},
+	}
+	b, err = bus.Merge(
+		bus.Fragment{Package: "example.com/db", Bus: db},
+		bus.Fragment{Package: "example.com/db", Bus: views},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fk, ok = b.Node("example.com/db/book_view").Role("schema").Fields[0].Value("fk").(*bus.Node)
+	if !ok || fk.Name != "example.com/db/genre" {
+		t.Fatalf("inherited fk not resolved within package: %v", fk)
+	}
+
+	// Defaults are compared after they are normalized.
+	withDefault := func(def interface{}) *bus.Bus {
+		role := table.Roles[0]
+		role.Properties = append([]bus.Property{}, role.Properties...)
+		role.Properties = append(role.Properties, bus.Property{Name: "length", Type: "int", Default: def})
+		return &bus.Bus{Types: []bus.NodeType{{Name: table.Name, Roles: []bus.RoleType{role}}}}
+	}
+	_, err = bus.Merge(
+		bus.Fragment{Package: "example.com/cue", Bus: withDefault(4)},
+		bus.Fragment{Package: "example.com/json", Bus: withDefault(json.Number("4"))},
+	)
+	if err != nil {
+		t.Fatalf("equal defaults: %v", err)
+	}
+	_, err = bus.Merge(
+		bus.Fragment{Package: "example.com/cue", Bus: withDefault(4)},
+		bus.Fragment{Package: "example.com/json", Bus: withDefault(json.Number("5"))},
+	)
+	if !errors.Is(err, bus.CodeMergeType) {
+		t.Fatalf("expected %q, got %v", bus.CodeMergeType, err)
+	}
+
+	other := table.Roles[0]
+	other.Properties = append([]bus.Property{}, other.Properties...)
+	other.Properties[1].Optional = false
+	conflict := &bus.Bus{
+		Types: []bus.NodeType{{Name: table.Name, Roles: []bus.RoleType{other}}},
+	}
+	_, err = bus.Merge(
+		bus.Fragment{Package: "example.com/db", Bus: db},
+		bus.Fragment{Package: "example.com/other", Bus: conflict},
+	)
+	if !errors.Is(err, bus.CodeMergeType) {
+		t.Fatalf("expected %q, got %v", bus.CodeMergeType, err)
+	}
+
+	missing := &bus.Bus{
+		Types: []bus.NodeType{ui},
+		Nodes: []bus.Node{
+			{
+				Name:  "author",
+				Type:  ui.Name,
+				Binds: []bus.Bind{{Alias: "b", Name: "writer"}},
+				Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{Alias: "b", KV: bus.KV{"name": "id"}}}}},
+			},
+		},
+	}
+	_, err = bus.Merge(
+		bus.Fragment{Package: "example.com/db", Bus: db},
+		bus.Fragment{Package: "example.com/ui", Bus: missing},
+	)
+	if !errors.Is(err, bus.CodeBindNode) {
+		t.Fatalf("expected %q, got %v", bus.CodeBindNode, err)
+	}
+}
@@ -1,47 +1,303 @@
 package bus
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
+// Code identifies the kind of a Diagnostic.
+// A Code may be used as the target of errors.Is to match a Diagnostic.
+type Code string
+
+func (c Code) Error() string {
+	return string(c)
+}
+
+const (
+	CodeOther Code = "other" // Error not otherwise classified.
+
+	CodeTypeDuplicate      Code = "type-duplicate"       // Node type defined more then once.
+	CodeTypeMissing        Code = "type-missing"         // Node type of a node not found.
+	CodeSideInvalid        Code = "side-invalid"         // Role type side is not a known side.
+	CodeRoleEmpty          Code = "role-empty"           // Role type has no properties.
+	CodeRoleDuplicate      Code = "role-duplicate"       // Role defined more then once in a node or node type.
+	CodeRoleUnknown        Code = "role-unknown"         // Node role not defined in the node type.
+	CodeRoleMissing        Code = "role-missing"         // Node type role not present in the node.
+	CodePropertyDuplicate  Code = "property-duplicate"   // Property defined more then once in a role type.
+	CodePropertyType       Code = "property-type"        // Property type is not a valid type.
+	CodeDefaultInvalid     Code = "default-invalid"      // Property default is not valid for the property type.
+	CodeNodeDuplicate      Code = "node-duplicate"       // Node name or alternate name defined more then once.
+	CodeBindAlias          Code = "bind-alias"           // Bind or field alias is missing, duplicated, or not bound.
+	CodeBindNode           Code = "bind-node"            // Bind references an unknown node.
+	CodeFieldCount         Code = "field-count"          // Role has the wrong number of fields.
+	CodeKeyUnknown         Code = "key-unknown"          // Field key is not a property of the role type.
+	CodeValueInvalid       Code = "value-invalid"        // Field value is not valid for the property type.
+	CodeFieldName          Code = "field-name"           // Field name property is invalid.
+	CodeFieldIDDuplicate   Code = "field-id-duplicate"   // Field ID used more then once in a role.
+	CodeFieldNameDuplicate Code = "field-name-duplicate" // Field name used more then once in a role.
+	CodeRecvRole           Code = "recv-role"            // Bound node is missing the role to receive from.
+	CodeRecvSource         Code = "recv-source"          // Bound node is missing the field to receive from.
+	CodeRecvConflict       Code = "recv-conflict"        // Received property type conflicts with sent property type.
+	CodeCircular           Code = "circular"             // Nodes reference each other in a cycle.
+	CodeConstraintInvalid  Code = "constraint-invalid"   // Property constraint is not valid for the property type.
+	CodeConstraint         Code = "constraint"           // Field value does not satisfy a property constraint.
+	CodeRequired           Code = "required"             // Field is missing a value for a property that is not optional.
+	CodeMergeType          Code = "merge-type"           // Node type is defined differently in merged packages.
+	CodeExtendBase         Code = "extend-base"          // Base node type not found or extended in a cycle.
+	CodeExtendOverride     Code = "extend-override"      // Role or property is not compatible with the inherited definition.
+	CodeDeprecated         Code = "deprecated"           // Node refers to a deprecated node or is of a deprecated node type.
+	CodeMigrationInvalid   Code = "migration-invalid"    // Node type migration is not valid or can not be applied.
+	CodeExprInvalid        Code = "expr-invalid"         // Property default expression is not valid.
+	CodeExprCircular       Code = "expr-circular"        // Property default expressions refer to each other in a cycle.
+	CodeExprValue          Code = "expr-value"           // Property default expression can not be evaluated or the result is not valid.
+	CodeRenameAmbiguous    Code = "rename-ambiguous"     // Alternate node names do not refer to a single previous node.
+	CodeScriptInvalid      Code = "script-invalid"       // Migration script is not complete or defined more then once.
+)
+
+// Severity of a Diagnostic.
+type Severity byte
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	default:
+		return "severity(" + strconv.Itoa(int(s)) + ")"
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	default:
+		return fmt.Errorf("bus: unknown severity %q", text)
+	case "error":
+		*s = SeverityError
+	case "warning":
+		*s = SeverityWarning
+	case "info":
+		*s = SeverityInfo
+	}
+	return nil
+}
+
+// Location of a Diagnostic within a bus. Unset names are empty.
+type Location struct {
+	NodeType string
+	Node     string
+	Role     string
+	Field    int // Field index within the role, -1 if not set.
+	Property string
+}
+
+// locType returns a location within a node type.
+func locType(nodeType, role, property string) Location {
+	return Location{NodeType: nodeType, Role: role, Field: -1, Property: property}
+}
+
+// locNode returns a location within a node.
+func locNode(node, role string, field int, property string) Location {
+	return Location{Node: node, Role: role, Field: field, Property: property}
+}
+
+func (l Location) String() string {
+	b := &strings.Builder{}
+	add := func(name, value string) {
+		if b.Len() > 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteString(name)
+		b.WriteRune(' ')
+		b.WriteString(value)
+	}
+	if len(l.NodeType) > 0 {
+		add("node type", strconv.Quote(l.NodeType))
+	}
+	if len(l.Node) > 0 {
+		add("node", strconv.Quote(l.Node))
+	}
+	if len(l.Role) > 0 {
+		add("role", strconv.Quote(l.Role))
+	}
+	if l.Field >= 0 {
+		add("field index", strconv.Itoa(l.Field))
+	}
+	if len(l.Property) > 0 {
+		add("property", strconv.Quote(l.Property))
+	}
+	return b.String()
+}
+
+// Diagnostic is a single located problem found in a bus.
+type Diagnostic struct {
+	Code     Code
+	Severity Severity
+	Location
+	Message string
+
+	// Err is the underlying cause, if any.
+	Err error `json:"-"`
+}
+
+func (d *Diagnostic) Error() string {
+	loc := d.Location.String()
+	if len(loc) == 0 {
+		return "bus: " + d.Message
+	}
+	return "bus: " + loc + ": " + d.Message
+}
+
+// Is reports if the target is the Code of the Diagnostic.
+func (d *Diagnostic) Is(target error) bool {
+	c, ok := target.(Code)
+	return ok && c == d.Code
+}
+
+func (d *Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+// Errors is a list of Diagnostics. A nil *Errors is an empty list
+// and may be appended to.
 type Errors struct {
-	Next *Errors
-	Err  error
+	List []*Diagnostic
 }
 
+// Append an error to the list. A *Diagnostic is appended as is, the
+// Diagnostics of an *Errors are all appended, and any other error is
+// appended as a Diagnostic with CodeOther.
 func (errs *Errors) Append(err error) *Errors {
-	if errs == nil {
-		return &Errors{Err: err}
+	if err == nil {
+		return errs
 	}
-	if errs.Next == nil {
-		errs.Next = &Errors{Err: err}
+	if list, ok := err.(*Errors); ok && (list == nil || len(list.List) == 0) {
 		return errs
 	}
-	errs.Next.Append(err)
+	if errs == nil {
+		errs = &Errors{}
+	}
+	switch err := err.(type) {
+	default:
+		errs.List = append(errs.List, &Diagnostic{
+			Code:     CodeOther,
+			Severity: SeverityError,
+			Location: Location{Field: -1},
+			Message:  err.Error(),
+			Err:      err,
+		})
+	case *Diagnostic:
+		errs.List = append(errs.List, err)
+	case *Errors:
+		errs.List = append(errs.List, err.List...)
+	}
 	return errs
 }
-func (errs *Errors) AppendMsg(f string, v ...interface{}) *Errors {
-	err := fmt.Errorf(f, v...)
-	return errs.Append(err)
+
+// at reports if any Diagnostic in the list is at the location.
+func (errs *Errors) at(loc Location) bool {
+	if errs == nil {
+		return false
+	}
+	for _, d := range errs.List {
+		if d.Location == loc {
+			return true
+		}
+	}
+	return false
 }
+
+// add appends an error Diagnostic with the given code, location and message.
+func (errs *Errors) add(code Code, loc Location, f string, v ...interface{}) *Errors {
+	return errs.addSeverity(SeverityError, code, loc, f, v...)
+}
+
+func (errs *Errors) addSeverity(sev Severity, code Code, loc Location, f string, v ...interface{}) *Errors {
+	var cause error
+	for _, a := range v {
+		if err, ok := a.(error); ok {
+			cause = err
+		}
+	}
+	return errs.Append(&Diagnostic{
+		Code:     code,
+		Severity: sev,
+		Location: loc,
+		Message:  fmt.Sprintf(f, v...),
+		Err:      cause,
+	})
+}
+
+// HasError reports if any Diagnostic has a SeverityError.
+func (errs *Errors) HasError() bool {
+	if errs == nil {
+		return false
+	}
+	for _, d := range errs.List {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
 func (errs *Errors) Error() string {
 	if errs == nil {
 		return ""
 	}
 	b := &strings.Builder{}
-	errs.writeTo(b)
+	for _, d := range errs.List {
+		b.WriteString(d.Error())
+		b.WriteRune('\n')
+	}
 	return b.String()
 }
-func (errs *Errors) writeTo(b *strings.Builder) {
+
+// Is reports if any Diagnostic in the list matches target.
+func (errs *Errors) Is(target error) bool {
 	if errs == nil {
-		return
+		return false
 	}
-	if errs.Err != nil {
-		b.WriteString(errs.Err.Error())
-		b.WriteRune('\n')
+	for _, d := range errs.List {
+		if errors.Is(d, target) {
+			return true
+		}
 	}
-	if errs.Next != nil {
-		errs.Next.writeTo(b)
+	return false
+}
+
+// As finds the first Diagnostic in the list that matches target.
+func (errs *Errors) As(target interface{}) bool {
+	if errs == nil {
+		return false
+	}
+	for _, d := range errs.List {
+		if errors.As(d, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON encodes the list of Diagnostics as a JSON array.
+func (errs *Errors) MarshalJSON() ([]byte, error) {
+	if errs == nil || len(errs.List) == 0 {
+		return []byte("[]"), nil
 	}
+	return json.Marshal(errs.List)
 }
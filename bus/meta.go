@@ -0,0 +1,71 @@
+package bus
+
+import (
+	"strconv"
+)
+
+// Meta is descriptive metadata of a node or node type.
+type Meta struct {
+	Description string            // Description of the node or node type.
+	Owner       string            // Owner of the node or node type, such as a team name.
+	Labels      map[string]string // Free-form labels.
+
+	// DeprecatedSince is the version or date since the node or node type
+	// is deprecated. If empty, it is not deprecated.
+	DeprecatedSince string
+	// Replacement is the name of the node or node type to use instead
+	// of the deprecated one.
+	Replacement string
+}
+
+// Deprecated reports if DeprecatedSince is set.
+func (m Meta) Deprecated() bool {
+	return len(m.DeprecatedSince) > 0
+}
+
+// deprecation returns the message for using a deprecated node or node type.
+func (m Meta) deprecation(kind, name string) string {
+	msg := kind + " " + strconv.Quote(name) + " is deprecated since " + m.DeprecatedSince
+	if len(m.Replacement) > 0 {
+		msg += ", use " + strconv.Quote(m.Replacement) + " instead"
+	}
+	return msg
+}
+
+// Warnings returns the warnings found when the bus was initialized, such as
+// references to deprecated nodes. Warnings do not cause Init to fail.
+func (b *Bus) Warnings() *Errors {
+	if b == nil {
+		return nil
+	}
+	return b.warnings
+}
+
+// checkDeprecated warns about nodes of a deprecated node type and about
+// binds and node values that refer to a deprecated node.
+func (b *Bus) checkDeprecated() *Errors {
+	var errs *Errors
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		if nt := n.nodeType; nt != nil && nt.Deprecated() {
+			errs = errs.addSeverity(SeverityWarning, CodeDeprecated, locNode(n.Name, "", -1, ""), "%s", nt.deprecation("node type", nt.Name))
+		}
+		for _, bd := range n.Binds {
+			if bd.node != nil && bd.node.Deprecated() {
+				errs = errs.addSeverity(SeverityWarning, CodeDeprecated, locNode(n.Name, "", -1, ""), "bind alias %q: %s", bd.Alias, bd.node.deprecation("node", bd.node.Name))
+			}
+		}
+		for ri := range n.Roles {
+			r := &n.Roles[ri]
+			for fi := range r.Fields {
+				f := &r.Fields[fi]
+				for _, key := range sortedKeys(f.values) {
+					if vn, ok := f.values[key].(*Node); ok && vn.Deprecated() {
+						errs = errs.addSeverity(SeverityWarning, CodeDeprecated, locNode(n.Name, r.Name, fi, key), "%s", vn.deprecation("node", vn.Name))
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
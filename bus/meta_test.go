@@ -0,0 +1,68 @@
+package bus_test
+
+import (
+	"errors"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestDeprecated(t *testing.T) {
+	types := []bus.NodeType{
+		updateTypes[0],
+		updateTypes[1],
+		{
+			Name:  "solidcoredata.org/test/old",
+			Roles: []bus.RoleType{{Name: "prop", Properties: []bus.Property{{Name: "name", Type: "text"}}}},
+			Meta:  bus.Meta{DeprecatedSince: "2"},
+		},
+	}
+	genre := updateTable("genre", "int", "")
+	genre.Meta = bus.Meta{
+		Description:     "Genre of a book.",
+		DeprecatedSince: "3",
+		Replacement:     "category",
+	}
+	b := &bus.Bus{
+		Types: types,
+		Nodes: []bus.Node{
+			genre,
+			updateTable("category", "int", ""),
+			updateTable("book", "int", "genre"),
+			updateUI("genre_ui", "genre"),
+			{
+				Name:  "old",
+				Type:  "solidcoredata.org/test/old",
+				Roles: []bus.Role{{Name: "prop", Fields: []bus.Field{{KV: bus.KV{"name": "old"}}}}},
+			},
+		},
+	}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	w := b.Warnings()
+	if w.HasError() {
+		t.Fatal("warnings must not have errors")
+	}
+	if !errors.Is(w, bus.CodeDeprecated) {
+		t.Fatalf("expected %q warnings, got %v", bus.CodeDeprecated, w)
+	}
+	got := map[string]bool{}
+	for _, d := range w.List {
+		if d.Severity != bus.SeverityWarning {
+			t.Fatalf("expected warning, got %v", d)
+		}
+		got[d.Node] = true
+	}
+	for _, name := range []string{"book", "genre_ui", "old"} {
+		if !got[name] {
+			t.Fatalf("missing warning for %q in %v", name, w)
+		}
+	}
+	if len(w.List) != 3 {
+		t.Fatalf("expected 3 warnings, got %v", w)
+	}
+	if g := b.Node("genre").Description; g != "Genre of a book." {
+		t.Fatalf("got description %q", g)
+	}
+}
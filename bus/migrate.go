@@ -0,0 +1,229 @@
+package bus
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MigrateOp is the operation of a MigrationStep.
+type MigrateOp string
+
+const (
+	MigrateRenameProperty MigrateOp = "rename-property" // Rename the Property of Role to To.
+	MigrateAddProperty    MigrateOp = "add-property"    // Set the Property of each field of Role to Value if unset.
+	MigrateRemoveProperty MigrateOp = "remove-property" // Remove the Property from each field of Role.
+	MigrateRenameRole     MigrateOp = "rename-role"     // Rename the Role to To.
+	MigrateAddRole        MigrateOp = "add-role"        // Add the Role without fields if missing.
+	MigrateRemoveRole     MigrateOp = "remove-role"     // Remove the Role.
+)
+
+// Migration upgrades the nodes of a node type from the prior version of
+// the node type to Version.
+type Migration struct {
+	Version int64
+	Steps   []MigrationStep
+}
+
+// MigrationStep is a single change to the nodes of a node type.
+type MigrationStep struct {
+	Op       MigrateOp
+	Role     string
+	Property string
+	To       string
+	Value    interface{}
+}
+
+// checkMigrations checks the migrations of the node type are in version order
+// and each step is complete.
+func (nt *NodeType) checkMigrations() *Errors {
+	var errs *Errors
+	var prev int64
+	for _, m := range nt.Migrations {
+		if m.Version <= prev {
+			errs = errs.add(CodeMigrationInvalid, locType(nt.Name, "", ""), "migration version %d must be greater then %d", m.Version, prev)
+		}
+		if m.Version > nt.Version {
+			errs = errs.add(CodeMigrationInvalid, locType(nt.Name, "", ""), "migration version %d is greater then node type version %d", m.Version, nt.Version)
+		}
+		prev = m.Version
+		for si, st := range m.Steps {
+			if err := st.check(); err != nil {
+				errs = errs.add(CodeMigrationInvalid, locType(nt.Name, st.Role, st.Property), "migration version %d step %d: %v", m.Version, si, err)
+			}
+		}
+	}
+	return errs
+}
+
+func (st MigrationStep) check() error {
+	if len(st.Role) == 0 {
+		return fmt.Errorf("missing Role")
+	}
+	switch st.Op {
+	default:
+		return fmt.Errorf("unknown op %q", st.Op)
+	case MigrateRenameProperty:
+		if len(st.Property) == 0 || len(st.To) == 0 {
+			return fmt.Errorf("op %q requires Property and To", st.Op)
+		}
+	case MigrateAddProperty:
+		if len(st.Property) == 0 || st.Value == nil {
+			return fmt.Errorf("op %q requires Property and Value", st.Op)
+		}
+	case MigrateRemoveProperty:
+		if len(st.Property) == 0 {
+			return fmt.Errorf("op %q requires Property", st.Op)
+		}
+	case MigrateRenameRole:
+		if len(st.To) == 0 {
+			return fmt.Errorf("op %q requires To", st.Op)
+		}
+	case MigrateAddRole, MigrateRemoveRole:
+	}
+	return nil
+}
+
+// Migrate upgrades the bus to the node types, which are usually the node
+// types of a more recent bus. The nodes of each node type with a version
+// less then the version in types are changed by each later migration of
+// the node type, in version order, and the node type is replaced with the
+// node type in types. Other node types are kept. The bus is then
+// initialized again.
+//
+// Migrate is used to compare a bus loaded from an older version with a
+// current bus after node types change. If the migrated bus is not valid,
+// the bus is left unchanged and the error is returned.
+func (b *Bus) Migrate(types []NodeType) error {
+	if b == nil {
+		return nil
+	}
+	from := make(map[string]int64, len(b.Types))
+	for _, nt := range b.Types {
+		from[nt.Name] = nt.Version
+	}
+	// upgrade contains the node types with a newer version.
+	upgrade := make(map[string]*NodeType)
+	for i := range types {
+		nt := &types[i]
+		v, ok := from[nt.Name]
+		if ok && v != nt.Version {
+			upgrade[nt.Name] = nt
+		}
+	}
+	if len(upgrade) == 0 {
+		return nil
+	}
+
+	var errs *Errors
+	nodes := make([]Node, len(b.Nodes))
+	for ni := range b.Nodes {
+		nodes[ni] = b.Nodes[ni].copy(nil)
+		n := &nodes[ni]
+		nt, ok := upgrade[n.Type]
+		if !ok {
+			continue
+		}
+		v := from[n.Type]
+		if v > nt.Version {
+			errs = errs.add(CodeMigrationInvalid, locNode(n.Name, "", -1, ""), "node type %q version %d is newer then version %d", n.Type, v, nt.Version)
+			continue
+		}
+		list := append([]Migration(nil), nt.Migrations...)
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+		for _, m := range list {
+			if m.Version <= v {
+				continue
+			}
+			for _, st := range m.Steps {
+				st.apply(n)
+			}
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	prevTypes, prevNodes := b.Types, b.Nodes
+	b.Types = make([]NodeType, len(prevTypes))
+	for i, nt := range prevTypes {
+		if up, ok := upgrade[nt.Name]; ok {
+			nt = *up
+		}
+		b.Types[i] = nt.copy(nil)
+	}
+	b.Nodes = nodes
+	b.setup = false
+	err := b.InitWith(b.opts)
+	if err == nil {
+		return nil
+	}
+	b.Types, b.Nodes = prevTypes, prevNodes
+	b.setup = false
+	if rerr := b.InitWith(b.opts); rerr != nil {
+		return fmt.Errorf("bus: unable to restore bus after migrate error %v: %w", err, rerr)
+	}
+	return err
+}
+
+// apply the step to the node. Field KV maps are copied before they are changed.
+func (st MigrationStep) apply(n *Node) {
+	switch st.Op {
+	case MigrateRenameRole:
+		for ri := range n.Roles {
+			if n.Roles[ri].Name == st.Role {
+				n.Roles[ri].Name = st.To
+			}
+		}
+		return
+	case MigrateAddRole:
+		for _, r := range n.Roles {
+			if r.Name == st.Role {
+				return
+			}
+		}
+		n.Roles = append(n.Roles, Role{Name: st.Role})
+		return
+	case MigrateRemoveRole:
+		roles := n.Roles[:0]
+		for _, r := range n.Roles {
+			if r.Name != st.Role {
+				roles = append(roles, r)
+			}
+		}
+		n.Roles = roles
+		return
+	}
+	for ri := range n.Roles {
+		r := &n.Roles[ri]
+		if r.Name != st.Role {
+			continue
+		}
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			v, has := f.KV[st.Property]
+			kv := make(KV, len(f.KV)+1)
+			for key, value := range f.KV {
+				kv[key] = value
+			}
+			switch st.Op {
+			case MigrateRenameProperty:
+				if !has {
+					continue
+				}
+				delete(kv, st.Property)
+				kv[st.To] = v
+			case MigrateAddProperty:
+				if has {
+					continue
+				}
+				kv[st.Property] = st.Value
+			case MigrateRemoveProperty:
+				if !has {
+					continue
+				}
+				delete(kv, st.Property)
+			}
+			f.KV = kv
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package bus_test
+
+import (
+	"errors"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+func TestMigrate(t *testing.T) {
+	v1 := bus.NodeType{
+		Name:    "solidcoredata.org/test/table",
+		Version: 1,
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "size", Type: "int", Optional: true},
+				},
+			},
+		},
+	}
+	v3 := bus.NodeType{
+		Name:    "solidcoredata.org/test/table",
+		Version: 3,
+		Roles: []bus.RoleType{
+			{
+				Name: "column",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true},
+					{Name: "length", Type: "int", Optional: true},
+					{Name: "nullable", Type: "bool"},
+				},
+			},
+		},
+		Migrations: []bus.Migration{
+			{Version: 2, Steps: []bus.MigrationStep{
+				{Op: bus.MigrateRenameProperty, Role: "schema", Property: "size", To: "length"},
+			}},
+			{Version: 3, Steps: []bus.MigrationStep{
+				{Op: bus.MigrateAddProperty, Role: "schema", Property: "nullable", Value: true},
+				{Op: bus.MigrateRenameRole, Role: "schema", To: "column"},
+			}},
+		},
+	}
+	previous := &bus.Bus{
+		Types: []bus.NodeType{v1},
+		Nodes: []bus.Node{{
+			Name:  "book",
+			Type:  v1.Name,
+			Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: bus.KV{"name": "title", "size": 100}}}}},
+		}},
+	}
+	current := &bus.Bus{
+		Types: []bus.NodeType{v3},
+		Nodes: []bus.Node{{
+			Name:  "book",
+			Type:  v3.Name,
+			Roles: []bus.Role{{Name: "column", Fields: []bus.Field{{KV: bus.KV{"name": "title", "length": 100, "nullable": true}}}}},
+		}},
+	}
+	if err := previous.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := current.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := previous.Migrate(current.Types); err != nil {
+		t.Fatal(err)
+	}
+	f := previous.Node("book").Role("column").Fields[0]
+	if g := f.Value("length"); g != int64(100) {
+		t.Fatalf("got length %v", g)
+	}
+	if g := f.Value("nullable"); g != true {
+		t.Fatalf("got nullable %v", g)
+	}
+	delta, err := bus.NewDelta(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta.Actions) != 0 {
+		t.Fatalf("expected no actions after migrate, got %d", len(delta.Actions))
+	}
+
+	bad := v3
+	bad.Migrations = []bus.Migration{{Version: 4}}
+	err = (&bus.Bus{Types: []bus.NodeType{bad}}).Init()
+	if !errors.Is(err, bus.CodeMigrationInvalid) {
+		t.Fatalf("expected %q, got %v", bus.CodeMigrationInvalid, err)
+	}
+}
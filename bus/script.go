@@ -0,0 +1,80 @@
+package bus
+
+import (
+	"strconv"
+)
+
+// ScriptStage is the point in the delta actions a Script runs at.
+type ScriptStage string
+
+const (
+	ScriptBefore       ScriptStage = "before"        // Before all other actions.
+	ScriptBeforeRemove ScriptStage = "before-remove" // After additions, renames, and updates, before removals.
+	ScriptAfter        ScriptStage = "after"         // After all other actions.
+)
+
+// Script is a migration script written by the bus author for an extension,
+// such as SQL to backfill a new column before the old column is removed.
+//
+// A script is tied to the transition from the previous version with the
+// sequence From to the version the script is committed with. A script
+// declared in the src bus sets From to the sequence of the most recent
+// commit. The script is stored with the committed version, so a delta
+// between the two versions includes it as an AlterScript action.
+type Script struct {
+	Name      string // Optional name, unique within the bus.
+	Extension string // Name of the extension that runs the script.
+	From      int64  // Sequence of the previous version.
+	Stage     ScriptStage
+	Content   string
+}
+
+// checkScripts checks each script is complete.
+func (b *Bus) checkScripts() *Errors {
+	var errs *Errors
+	names := make(map[string]bool, len(b.Scripts))
+	for i, s := range b.Scripts {
+		name := "index " + strconv.Itoa(i)
+		if len(s.Name) > 0 {
+			if names[s.Name] {
+				errs = errs.add(CodeScriptInvalid, Location{Field: -1}, "script %q defined more then once", s.Name)
+				continue
+			}
+			names[s.Name] = true
+			name = strconv.Quote(s.Name)
+		}
+		switch {
+		case len(s.Extension) == 0:
+			errs = errs.add(CodeScriptInvalid, Location{Field: -1}, "script %s missing extension", name)
+		case len(s.Content) == 0:
+			errs = errs.add(CodeScriptInvalid, Location{Field: -1}, "script %s missing content", name)
+		case s.From < 0:
+			errs = errs.add(CodeScriptInvalid, Location{Field: -1}, "script %s from sequence %d may not be negative", name, s.From)
+		}
+		switch s.Stage {
+		default:
+			errs = errs.add(CodeScriptInvalid, Location{Field: -1}, "script %s unknown stage %q", name, s.Stage)
+		case ScriptBefore, ScriptBeforeRemove, ScriptAfter:
+		}
+	}
+	return errs
+}
+
+// scriptActions returns the script actions of the stage for the transition
+// from the previous version.
+func (db *DeltaBus) scriptActions(stage ScriptStage) []DeltaAction {
+	if db.Previous == nil {
+		return nil
+	}
+	var ret []DeltaAction
+	for _, s := range db.Current.Scripts {
+		if s.Stage != stage || s.From != db.Previous.Version.Sequence {
+			continue
+		}
+		ret = append(ret, DeltaAction{
+			Alter:  AlterScript,
+			Script: s.Content,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,372 @@
+package bus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector selects nodes, roles, or fields from a bus.
+//
+// A selector starts by selecting nodes by type, by name, or all nodes:
+//
+//	type=solidcoredata.org/t/db/table
+//	name=app1.coredata.biz/n/table/book
+//	*
+//
+// A role name may follow the node selection to select that role of each node:
+//
+//	type=solidcoredata.org/t/db/table/schema
+//	*/schema
+//
+// Predicates in square brackets after a role select the fields of the role
+// that match all predicates:
+//
+//	type=solidcoredata.org/t/db/table/schema[key=true]
+//	*/schema[type=text,nullable!=true]
+//	*/schema[fk]
+//	*/schema[*]
+//
+// A predicate is one of "key=value", "key!=value", "key" (the key has a value),
+// "!key" (the key has no value), or "*" (all fields). Values are converted to
+// the property type before comparing and may be quoted. A value matches a list
+// property if any item in the list is equal to the value. A node value matches
+// the node name.
+//
+// Because node type and node names may contain "/", the role name is the
+// remainder after the longest node type or node name found in the bus.
+type Selector struct {
+	raw   string
+	by    string // "type", "name", or "*".
+	path  string
+	preds []predicate
+	field bool // True if fields are selected.
+}
+
+type predicate struct {
+	key   string
+	op    string // "=", "!=", "has", "!has", or "*".
+	value string
+}
+
+// Match is a single result of a Selector.
+// Role is nil if nodes are selected, and Field is nil unless fields are selected.
+type Match struct {
+	Node       *Node
+	Role       *Role
+	Field      *Field
+	FieldIndex int
+}
+
+func (m Match) String() string {
+	b := &strings.Builder{}
+	b.WriteString(m.Node.Name)
+	if m.Role != nil {
+		b.WriteRune('/')
+		b.WriteString(m.Role.Name)
+	}
+	if m.Field != nil {
+		b.WriteRune('[')
+		b.WriteString(strconv.Itoa(m.FieldIndex))
+		b.WriteRune(']')
+		if len(m.Field.name) > 0 {
+			b.WriteRune(' ')
+			b.WriteString(m.Field.name)
+		}
+	}
+	return b.String()
+}
+
+// ParseSelector parses the selector text. See Selector for the syntax.
+func ParseSelector(s string) (*Selector, error) {
+	sel := &Selector{raw: s}
+	head := strings.TrimSpace(s)
+	if strings.HasSuffix(head, "]") {
+		open := predicateStart(head)
+		if open < 0 {
+			return nil, fmt.Errorf("bus: selector %q missing %q", s, "[")
+		}
+		preds, err := parsePredicates(head[open+1 : len(head)-1])
+		if err != nil {
+			return nil, fmt.Errorf("bus: selector %q %w", s, err)
+		}
+		sel.preds = preds
+		sel.field = true
+		head = head[:open]
+	}
+	switch {
+	default:
+		return nil, fmt.Errorf("bus: selector %q must start with %q, %q, or %q", s, "type=", "name=", "*")
+	case head == "*":
+		sel.by = "*"
+	case strings.HasPrefix(head, "*/"):
+		sel.by = "*"
+		sel.path = head[2:]
+	case strings.HasPrefix(head, "type="):
+		sel.by = "type"
+		sel.path = head[len("type="):]
+	case strings.HasPrefix(head, "name="):
+		sel.by = "name"
+		sel.path = head[len("name="):]
+	}
+	if sel.by != "*" && len(sel.path) == 0 {
+		return nil, fmt.Errorf("bus: selector %q missing %s", s, sel.by)
+	}
+	if sel.field && sel.by == "*" && len(sel.path) == 0 {
+		return nil, fmt.Errorf("bus: selector %q predicates require a role", s)
+	}
+	return sel, nil
+}
+
+// MustParseSelector is like ParseSelector but panics on error.
+func MustParseSelector(s string) *Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+func (sel *Selector) String() string {
+	return sel.raw
+}
+
+// predicateStart returns the index of the "[" that starts the trailing predicates.
+func predicateStart(s string) int {
+	inQuote := false
+	start := -1
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == '[' && !inQuote && start < 0:
+			start = i
+		}
+	}
+	return start
+}
+
+func parsePredicates(s string) ([]predicate, error) {
+	var parts []string
+	inQuote := false
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == ',' && !inQuote:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	parts = append(parts, s[last:])
+
+	preds := make([]predicate, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		// The operator is before any quoted value.
+		head := p
+		if i := strings.IndexByte(p, '"'); i >= 0 {
+			head = p[:i]
+		}
+		var pr predicate
+		switch {
+		case len(p) == 0:
+			return nil, fmt.Errorf("empty predicate")
+		case p == "*":
+			pr.op = "*"
+		case strings.HasPrefix(p, "!") && !strings.Contains(head, "="):
+			pr.op = "!has"
+			pr.key = strings.TrimSpace(p[1:])
+		case strings.Contains(head, "!="):
+			i := strings.Index(head, "!=")
+			pr.op = "!="
+			pr.key, pr.value = strings.TrimSpace(p[:i]), strings.TrimSpace(p[i+2:])
+		case strings.Contains(head, "="):
+			i := strings.Index(head, "=")
+			pr.op = "="
+			pr.key, pr.value = strings.TrimSpace(p[:i]), strings.TrimSpace(p[i+1:])
+		default:
+			pr.op = "has"
+			pr.key = p
+		}
+		if pr.op != "*" && len(pr.key) == 0 {
+			return nil, fmt.Errorf("predicate %q missing key", p)
+		}
+		if strings.HasPrefix(pr.value, `"`) {
+			v, err := strconv.Unquote(pr.value)
+			if err != nil {
+				return nil, fmt.Errorf("predicate %q invalid quoted value: %w", p, err)
+			}
+			pr.value = v
+		}
+		preds = append(preds, pr)
+	}
+	return preds, nil
+}
+
+// Select the matches of the selector text from the bus.
+func (b *Bus) Select(selector string) ([]Match, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(b)
+}
+
+// Select the matches of the selector from the bus. The bus must be initialized.
+// Matches are returned in bus node order.
+func (sel *Selector) Select(b *Bus) ([]Match, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if !b.setup {
+		return nil, fmt.Errorf("bus: select %q on a bus that is not initialized", sel.raw)
+	}
+	var nodes []*Node
+	var role string
+	switch sel.by {
+	case "*":
+		for ni := range b.Nodes {
+			nodes = append(nodes, &b.Nodes[ni])
+		}
+		role = sel.path
+	case "type":
+		names := make([]string, 0, len(b.typeLookup))
+		for name := range b.typeLookup {
+			names = append(names, name)
+		}
+		var tp string
+		tp, role = splitLongest(sel.path, names)
+		if len(tp) == 0 {
+			return nil, nil
+		}
+		nodes = b.nodeByType[tp]
+	case "name":
+		names := make([]string, 0, len(b.nodeLookup))
+		for name := range b.nodeLookup {
+			names = append(names, name)
+		}
+		var name string
+		name, role = splitLongest(sel.path, names)
+		if len(name) == 0 {
+			return nil, nil
+		}
+		nodes = []*Node{b.nodeLookup[name]}
+	}
+	if strings.Contains(role, "/") {
+		return nil, fmt.Errorf("bus: selector %q invalid role name %q", sel.raw, role)
+	}
+	if sel.field && len(role) == 0 {
+		return nil, fmt.Errorf("bus: selector %q predicates require a role", sel.raw)
+	}
+
+	var ret []Match
+	for _, n := range nodes {
+		if len(role) == 0 {
+			ret = append(ret, Match{Node: n, FieldIndex: -1})
+			continue
+		}
+		r := n.Role(role)
+		if r == nil {
+			continue
+		}
+		if !sel.field {
+			ret = append(ret, Match{Node: n, Role: r, FieldIndex: -1})
+			continue
+		}
+		for fi := range r.Fields {
+			f := &r.Fields[fi]
+			if !sel.matchField(r, f) {
+				continue
+			}
+			ret = append(ret, Match{Node: n, Role: r, Field: f, FieldIndex: fi})
+		}
+	}
+	return ret, nil
+}
+
+// splitLongest finds the longest name in names that is equal to s or is a prefix
+// of s followed by "/". It returns the name and the remainder after the "/".
+func splitLongest(s string, names []string) (name string, rest string) {
+	for _, n := range names {
+		switch {
+		case s == n:
+			if len(n) > len(name) {
+				name, rest = n, ""
+			}
+		case strings.HasPrefix(s, n+"/"):
+			if len(n) > len(name) {
+				name, rest = n, s[len(n)+1:]
+			}
+		}
+	}
+	return name, rest
+}
+
+func (sel *Selector) matchField(r *Role, f *Field) bool {
+	for _, p := range sel.preds {
+		if !p.match(r, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p predicate) match(r *Role, f *Field) bool {
+	if p.op == "*" {
+		return true
+	}
+	pr := r.roleType.propNameLookup[p.key]
+	if pr == nil {
+		return false
+	}
+	v := f.values[p.key]
+	switch p.op {
+	case "has":
+		return v != nil
+	case "!has":
+		return v == nil
+	}
+	eq := predicateEqual(pr, v, p.value)
+	if p.op == "!=" {
+		return !eq
+	}
+	return eq
+}
+
+// predicateEqual reports if the normalized value v is equal to the text of the
+// predicate value, converted to the property type.
+func predicateEqual(pr *Property, v interface{}, text string) bool {
+	if v == nil {
+		return false
+	}
+	if list, ok := v.([]interface{}); ok {
+		et := strings.TrimPrefix(pr.Type, listPrefix)
+		for _, item := range list {
+			if elemEqual(et, pr.Enum, item, text) {
+				return true
+			}
+		}
+		return false
+	}
+	return elemEqual(pr.Type, pr.Enum, v, text)
+}
+
+func elemEqual(tp string, enum []string, v interface{}, text string) bool {
+	if n, ok := v.(*Node); ok {
+		return n.Name == text
+	}
+	want, err := validElem(tp, enum, text, func(string) *Node { return nil })
+	if err != nil {
+		return false
+	}
+	return valueEqual(v, want)
+}
@@ -0,0 +1,107 @@
+package bus_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+	"solidcoredata.org/src/databus/bus/load"
+)
+
+func TestSelect(t *testing.T) {
+	var input = `
+{
+    Types: [
+        {
+            Name: "solidcoredata.org/t/db/table",
+            Roles: [
+                {
+                    Name: "schema",
+                    Properties: [
+                        {Name: "name", Type: "text", FieldName: true},
+                        {Name: "type", Type: "text"},
+                        {Name: "key", Type: "bool", Default: false},
+                        {Name: "fk", Type: "node", Optional: true},
+                        {Name: "tags", Type: "[]text", Optional: true},
+                    ],
+                },
+            ],
+        },
+    ],
+    Nodes: [
+        {
+            Name: "app/n/table/genre",
+            Type: "solidcoredata.org/t/db/table",
+            Roles: [
+                {Name: "schema", Fields: [
+                    {KV: {name: "id", type: "int", key: true}},
+                    {KV: {name: "name", type: "text", tags: ["a, b", "c", "x!=y"]}},
+                ]},
+            ],
+        },
+        {
+            Name: "app/n/table/book",
+            Type: "solidcoredata.org/t/db/table",
+            Roles: [
+                {Name: "schema", Fields: [
+                    {KV: {name: "id", type: "int", key: true}},
+                    {KV: {name: "name", type: "text"}},
+                    {KV: {name: "genre", type: "int", fk: "app/n/table/genre"}},
+                ]},
+            ],
+        },
+    ],
+}
+    `
+
+	ctx := context.Background()
+	b, err := load.BusReader(ctx, strings.NewReader(throughJsonnet(t, input)))
+	if err != nil {
+		t.Fatal("load", err)
+	}
+	if err = b.Init(); err != nil {
+		t.Fatal("validate", err)
+	}
+
+	list := []struct {
+		Sel  string
+		Want []string
+	}{
+		{"type=solidcoredata.org/t/db/table", []string{"app/n/table/genre", "app/n/table/book"}},
+		{"name=app/n/table/book", []string{"app/n/table/book"}},
+		{"name=app/n/table/book/schema", []string{"app/n/table/book/schema"}},
+		{"type=solidcoredata.org/t/db/table/schema[key=true]", []string{"app/n/table/genre/schema[0] id", "app/n/table/book/schema[0] id"}},
+		{"*/schema[type=int,key!=true]", []string{"app/n/table/book/schema[2] genre"}},
+		{"*/schema[fk=app/n/table/genre]", []string{"app/n/table/book/schema[2] genre"}},
+		{"*/schema[fk]", []string{"app/n/table/book/schema[2] genre"}},
+		{`*/schema[tags="a, b"]`, []string{"app/n/table/genre/schema[1] name"}},
+		{`*/schema[tags="x!=y"]`, []string{"app/n/table/genre/schema[1] name"}},
+		{`*/schema[name="a!=b"]`, nil},
+		{"name=app/n/table/genre/schema[!tags]", []string{"app/n/table/genre/schema[0] id"}},
+		{"name=app/n/table/genre/schema[*]", []string{"app/n/table/genre/schema[0] id", "app/n/table/genre/schema[1] name"}},
+		{"type=solidcoredata.org/t/db/missing", nil},
+		{"*/missing", nil},
+	}
+	for _, item := range list {
+		t.Run(item.Sel, func(t *testing.T) {
+			mm, err := b.Select(item.Sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(mm))
+			for i, m := range mm {
+				got[i] = m.String()
+			}
+			if strings.Join(got, "\n") != strings.Join(item.Want, "\n") {
+				t.Fatalf("got %q want %q", got, item.Want)
+			}
+		})
+	}
+
+	for _, sel := range []string{"", "table", "type=", "*[key=true]", `*/schema[name="x]`, "*/schema[,]"} {
+		if _, err := bus.ParseSelector(sel); err == nil {
+			t.Errorf("expected error for %q", sel)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package bus
+
+import (
+	"fmt"
+)
+
+// Update replaces the node of the same name in an initialized bus.
+//
+// Only the node and the nodes that depend on it, directly or indirectly,
+// are checked again and receive values again. If the node now depends on a
+// node that is ordered after it, the node and its dependents are moved
+// after that node. This is much faster then initializing a large bus again.
+//
+// A node that is not in the bus, or that changes the node type or the
+// alternate names, is added or replaced using Edit, which initializes the
+// entire bus again.
+//
+// If the updated node is not valid, the bus is left unchanged and the error is
+// returned. The node must not share roles or fields with the bus.
+func (b *Bus) Update(n Node) error {
+	if b == nil {
+		return nil
+	}
+	if !b.setup {
+		return fmt.Errorf("bus: update node %q on a bus that is not initialized", n.Name)
+	}
+	cur := b.nodeLookup[n.Name]
+	if cur == nil || cur.Name != n.Name || cur.Type != n.Type || !sameNames(cur.NameAlt, n.NameAlt) {
+		return b.Edit(func(e *Editor) error {
+			if i, ok := e.index[n.Name]; ok {
+				e.b.Nodes[i] = n
+				return nil
+			}
+			e.b.Nodes = append(e.b.Nodes, n)
+			return nil
+		})
+	}
+	findNode := b.Node
+	if b.opts.AllowExternal {
+		findNode = b.nodeOrExternal
+	}
+
+	index := -1
+	for ni := range b.Nodes {
+		if &b.Nodes[ni] == cur {
+			index = ni
+			break
+		}
+	}
+	old := *cur
+	n.nodeType = old.nodeType
+	n.readOnly = old.readOnly
+	b.Nodes[index] = n
+	p := &b.Nodes[index]
+
+	if errs := b.initNode(p, findNode); errs != nil {
+		b.Nodes[index] = old
+		return errs
+	}
+
+	// affected contains the node and each node that depends on it.
+	// As nodes are sorted with dependencies first, dependents are after the node.
+	affected := map[string]bool{p.Name: true}
+	for ni := index + 1; ni < len(b.Nodes); ni++ {
+		an := &b.Nodes[ni]
+		for _, name := range an.ToNode() {
+			if affected[name] {
+				affected[an.Name] = true
+				break
+			}
+		}
+	}
+	last := index
+	for _, name := range p.ToNode() {
+		if name == p.Name {
+			// A node may refer to itself.
+			continue
+		}
+		if affected[name] {
+			b.Nodes[index] = old
+			return (*Errors)(nil).add(CodeCircular, locNode(p.Name, "", -1, ""), "node depends on node %q which depends on it", name)
+		}
+		dep := b.nodeLookup[name]
+		if dep == nil {
+			continue
+		}
+		for ni := index + 1; ni < len(b.Nodes); ni++ {
+			if &b.Nodes[ni] == dep && ni > last {
+				last = ni
+			}
+		}
+	}
+	if last > index {
+		b.reorder(index, last, affected)
+	}
+
+	errs := b.recheck(affected, findNode)
+	if errs == nil {
+		b.warnings = b.checkDeprecated()
+		return nil
+	}
+	// Restore the previous node. The order is still valid as the previous
+	// node only depends on nodes ordered before it.
+	p = b.nodeLookup[old.Name]
+	*p = old
+	if rerr := b.recheck(affected, findNode); rerr != nil {
+		return fmt.Errorf("bus: unable to restore node %q after update error %v: %w", old.Name, errs, rerr)
+	}
+	return errs
+}
+
+// reorder moves the nodes in affected from the range of node indexes
+// [start, end] to after the other nodes in the range, keeping the
+// relative order of both groups of nodes. Node pointers are updated.
+func (b *Bus) reorder(start, end int, affected map[string]bool) {
+	ptrName := make(map[*Node]string, len(b.Nodes))
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		ptrName[n] = n.Name
+	}
+	region := make([]Node, 0, end-start+1)
+	for ni := start; ni <= end; ni++ {
+		if !affected[b.Nodes[ni].Name] {
+			region = append(region, b.Nodes[ni])
+		}
+	}
+	for ni := start; ni <= end; ni++ {
+		if affected[b.Nodes[ni].Name] {
+			region = append(region, b.Nodes[ni])
+		}
+	}
+	copy(b.Nodes[start:], region)
+	b.relink(ptrName)
+}
+
+// recheck checks each affected node again in node order, then fills
+// received values and checks required values.
+func (b *Bus) recheck(affected map[string]bool, findNode func(name string) *Node) *Errors {
+	var errs *Errors
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		if affected[n.Name] {
+			errs = errs.Append(b.initNode(n, findNode))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		if affected[n.Name] {
+			errs = errs.Append(propagateNode(n))
+			errs = errs.Append(deriveNode(n))
+		}
+	}
+	for ni := range b.Nodes {
+		n := &b.Nodes[ni]
+		if affected[n.Name] {
+			errs = errs.Append(checkRequiredNode(n, errs))
+		}
+	}
+	return errs
+}
+
+// sameNames reports if both name lists are equal.
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package bus_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+var updateTypes = []bus.NodeType{
+	{
+		Name: "solidcoredata.org/test/table",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text", FieldName: true, Send: true},
+					{Name: "type", Type: "text", Send: true},
+					{Name: "fk", Type: "node", Optional: true},
+				},
+			},
+		},
+	},
+	{
+		Name: "solidcoredata.org/test/ui",
+		Roles: []bus.RoleType{
+			{
+				Name: "schema",
+				Properties: []bus.Property{
+					{Name: "name", Type: "text"},
+					{Name: "type", Type: "text", Recv: true},
+				},
+			},
+		},
+	},
+}
+
+func updateTable(name, fieldType, fk string) bus.Node {
+	kv := bus.KV{"name": "id", "type": fieldType}
+	if len(fk) > 0 {
+		kv["fk"] = fk
+	}
+	return bus.Node{
+		Name:  name,
+		Type:  updateTypes[0].Name,
+		Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{KV: kv}}}},
+	}
+}
+
+func updateUI(name, table string) bus.Node {
+	return bus.Node{
+		Name:  name,
+		Type:  updateTypes[1].Name,
+		Binds: []bus.Bind{{Alias: "t", Name: table}},
+		Roles: []bus.Role{{Name: "schema", Fields: []bus.Field{{Alias: "t", KV: bus.KV{"name": "id"}}}}},
+	}
+}
+
+// updateBus returns a bus with count tables, each with a UI node bound to it.
+func updateBus(count int) *bus.Bus {
+	b := &bus.Bus{Types: updateTypes}
+	for i := 0; i < count; i++ {
+		table := fmt.Sprintf("table_%d", i)
+		b.Nodes = append(b.Nodes, updateTable(table, "int", ""), updateUI(fmt.Sprintf("ui_%d", i), table))
+	}
+	return b
+}
+
+func TestUpdate(t *testing.T) {
+	b := updateBus(3)
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	index := func(name string) int {
+		for i := range b.Nodes {
+			if b.Nodes[i].Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// Changed values are received by the bound node.
+	if err := b.Update(updateTable("table_1", "text", "")); err != nil {
+		t.Fatal(err)
+	}
+	if g := b.Node("ui_1").Role("schema").Fields[0].Value("type"); g != "text" {
+		t.Fatalf("expected received type text, got %v", g)
+	}
+
+	// Depend on a node ordered later.
+	if err := b.Update(updateTable("table_0", "int", "table_2")); err != nil {
+		t.Fatal(err)
+	}
+	if index("table_0") < index("table_2") {
+		t.Fatal("table_0 must be ordered after table_2")
+	}
+	if index("ui_0") < index("table_0") {
+		t.Fatal("ui_0 must be ordered after table_0")
+	}
+	fk := b.Node("table_0").Role("schema").Fields[0].Value("fk").(*bus.Node)
+	if fk != b.Node("table_2") {
+		t.Fatal("fk not linked to table_2")
+	}
+	if bound := b.Node("ui_0").BindAlias("t").Node(); bound != b.Node("table_0") {
+		t.Fatal("bind not linked to table_0")
+	}
+
+	// A cycle is an error and the bus is unchanged.
+	err := b.Update(updateTable("table_2", "int", "table_0"))
+	if !errors.Is(err, bus.CodeCircular) {
+		t.Fatalf("expected %q, got %v", bus.CodeCircular, err)
+	}
+	if g := b.Node("table_2").Role("schema").Fields[0].Value("fk"); g != nil {
+		t.Fatalf("expected unchanged table_2, got fk %v", g)
+	}
+
+	// A node may refer to itself.
+	if err := b.Update(updateTable("table_1", "text", "table_1")); err != nil {
+		t.Fatal(err)
+	}
+	if fk := b.Node("table_1").Role("schema").Fields[0].Value("fk"); fk != b.Node("table_1") {
+		t.Fatalf("expected fk linked to table_1, got %v", fk)
+	}
+
+	// An invalid node is an error and the bus is unchanged.
+	err = b.Update(updateTable("table_1", "text", "missing"))
+	if !errors.Is(err, bus.CodeValueInvalid) {
+		t.Fatalf("expected %q, got %v", bus.CodeValueInvalid, err)
+	}
+	if g := b.Node("ui_1").Role("schema").Fields[0].Value("type"); g != "text" {
+		t.Fatalf("expected unchanged received type, got %v", g)
+	}
+
+	// New nodes are added.
+	if err := b.Update(updateUI("ui_new", "table_2")); err != nil {
+		t.Fatal(err)
+	}
+	if b.Node("ui_new") == nil {
+		t.Fatal("missing ui_new")
+	}
+
+	// The updated bus is the same as a bus initialized in full,
+	// independent of the order the nodes are listed in.
+	h1, err := b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := &bus.Bus{Types: updateTypes}
+	for _, n := range b.Nodes {
+		full.Nodes = append(full.Nodes, bus.Node{Name: n.Name, Type: n.Type, Roles: n.Roles, Binds: n.Binds})
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(full.Nodes), func(i, j int) {
+		full.Nodes[i], full.Nodes[j] = full.Nodes[j], full.Nodes[i]
+	})
+	if err := full.Init(); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := full.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 {
+		t.Fatal("updated bus differs from bus initialized in full")
+	}
+}
+
+const benchmarkNodes = 2000
+
+func BenchmarkInit(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		bb := updateBus(benchmarkNodes)
+		b.StartTimer()
+		if err := bb.Init(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	bb := updateBus(benchmarkNodes)
+	if err := bb.Init(); err != nil {
+		b.Fatal(err)
+	}
+	types := []string{"int", "text"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table := fmt.Sprintf("table_%d", (i*7)%benchmarkNodes)
+		if err := bb.Update(updateTable(table, types[i%2], "")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package bus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/apd/v2"
+)
+
+// Date is a calendar date without a time or time zone.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ParseDate parses an RFC 3339 full-date, such as "2006-01-02".
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return Date{}, err
+	}
+	return Date{Year: t.Year(), Month: t.Month(), Day: t.Day()}, nil
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// UUID is a 16 byte universally unique identifier.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in the form "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx".
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("invalid uuid %q", s)
+	}
+	h := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	_, err := hex.Decode(u[:], []byte(h))
+	if err != nil {
+		return u, fmt.Errorf("invalid uuid %q: %w", s, err)
+	}
+	return u, nil
+}
+
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// normalizeJSON validates the JSON text and returns it with sorted object keys
+// and without insignificant white space.
+func normalizeJSON(raw []byte) (json.RawMessage, error) {
+	coder := json.NewDecoder(bytes.NewReader(raw))
+	coder.UseNumber()
+	var v interface{}
+	err := coder.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	if coder.More() {
+		return nil, fmt.Errorf("invalid json: more then one value")
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})), nil
+}
+
+// valueEqual reports if two normalized values are equal.
+// Nodes are equal if they have the same name.
+func valueEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	default:
+		return a == b
+	case *apd.Decimal:
+		b, ok := b.(*apd.Decimal)
+		if !ok || a == nil || b == nil {
+			return ok && a == b
+		}
+		return a.Cmp(b) == 0
+	case []byte:
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	case json.RawMessage:
+		b, ok := b.(json.RawMessage)
+		return ok && bytes.Equal(a, b)
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	case *Node:
+		b, ok := b.(*Node)
+		if !ok || a == nil || b == nil {
+			return ok && a == b
+		}
+		return a.Name == b.Name || a.renamedFrom(b.Name) || b.renamedFrom(a.Name)
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !valueEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -2,6 +2,7 @@ package caller
 
 import (
 	"context"
+	"io"
 
 	"solidcoredata.org/src/databus/bus"
 )
@@ -17,6 +18,7 @@ import (
 //    - Later it could be changed to a plugin system like github.com/hashicorp/go-plugin.
 type SimpleCaller struct {
 	busRead      BusReader
+	config       ConfigReader
 	busVersion   BusVersioner
 	extReadWrite ExtensionReadWriter
 	extReg       ExtensionRegister
@@ -24,6 +26,7 @@ type SimpleCaller struct {
 
 type CallerSetup struct {
 	Bus       BusReader
+	Config    ConfigReader // Optional, if nil the default configuration is used.
 	Versioner BusVersioner
 	ExtRW     ExtensionReadWriter
 	ExtReg    ExtensionRegister
@@ -32,6 +35,7 @@ type CallerSetup struct {
 func NewCaller(setup CallerSetup) (*SimpleCaller, error) {
 	return &SimpleCaller{
 		busRead:      setup.Bus,
+		config:       setup.Config,
 		busVersion:   setup.Versioner,
 		extReadWrite: setup.ExtRW,
 		extReg:       setup.ExtReg,
@@ -54,23 +58,112 @@ func (c *SimpleCaller) listExt(ctx context.Context) ([]Extension, error) {
 	return ret, nil
 }
 
-func (c *SimpleCaller) Validate(ctx context.Context) error {
+// filter the bus to the node types the extension handles. References to
+// nodes that are not handled by the extension are left as external nodes,
+// unless the extension requests them as context.
+func filter(b *bus.Bus, about ExtensionAbout) (*bus.Bus, error) {
+	f := b.FilterWith(bus.FilterOptions{
+		Types:     about.HandleTypes,
+		Side:      about.Side,
+		Closure:   about.Context,
+		Extension: about.Name,
+	})
+	return f, f.InitWith(bus.InitOptions{AllowExternal: true})
+}
+
+// Validate the bus and the bus of each extension. If the bus is valid, the
+// returned Diagnostics are the warnings of the bus, such as references to
+// deprecated nodes. The error is set if the bus is not valid.
+func (c *SimpleCaller) Validate(ctx context.Context) (*bus.Errors, error) {
 	b, err := c.busRead.GetBus(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	exts, err := c.listExt(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, ext := range exts {
 		about := ext.AboutSelf()
-		err = ext.Validate(ctx, b.Filter(about.HandleTypes))
+		fb, err := filter(b, about)
+		if err != nil {
+			return nil, err
+		}
+		err = ext.Validate(ctx, fb)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = b.Init(); err != nil {
+		return nil, err
+	}
+	return b.Warnings(), nil
+}
+
+// Lint the current bus with the built-in lint rules and the lint rules of each
+// extension, configured by the project configuration. The returned Diagnostics
+// are the lint findings, the error is set if the lint could not be run.
+func (c *SimpleCaller) Lint(ctx context.Context) (*bus.Errors, error) {
+	config := &Config{}
+	if c.config != nil {
+		var err error
+		config, err = c.config.GetConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b, err := c.busRead.GetBus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exts, err := c.listExt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l := bus.NewLinter()
+	for _, ext := range exts {
+		lext, ok := ext.(LintExtension)
+		if !ok {
+			continue
+		}
+		if err = l.Add(lext.LintRules()...); err != nil {
+			return nil, err
+		}
+	}
+	return l.Lint(b, config.Lint)
+}
+
+// Query the current bus with the selector, see bus.Selector.
+func (c *SimpleCaller) Query(ctx context.Context, selector string) ([]bus.Match, error) {
+	sel, err := bus.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.busRead.GetBus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(b)
+}
+
+// Graph writes the node graph of the src bus to w. If changes is true,
+// the nodes changed since the most recent commit are highlighted.
+func (c *SimpleCaller) Graph(ctx context.Context, w io.Writer, opts bus.GraphOptions, changes bool) error {
+	b, err := c.busRead.GetBus(ctx)
+	if err != nil {
+		return err
+	}
+	if changes {
+		previous, err := c.busVersion.Get(ctx, bus.Version{Sequence: 0})
+		if err != nil {
+			return err
+		}
+		opts.Delta, err = bus.NewDelta(b, previous)
 		if err != nil {
 			return err
 		}
 	}
-	return b.Init()
+	return b.WriteGraph(w, opts)
 }
 
 func (c *SimpleCaller) currentPrevious(ctx context.Context, src bool) (current *bus.Bus, previous *bus.Bus, exts []Extension, err error) {
@@ -94,17 +187,30 @@ func (c *SimpleCaller) currentPrevious(ctx context.Context, src bool) (current *
 			return nil, nil, nil, err
 		}
 	}
+	// Upgrade the previous bus nodes to the current node types.
+	err = b2.Migrate(b1.Types)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	exts, err = c.listExt(ctx)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 	for _, ext := range exts {
 		about := ext.AboutSelf()
-		err = ext.Validate(ctx, b1.Filter(about.HandleTypes))
+		fb1, err := filter(b1, about)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = ext.Validate(ctx, fb1)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		err = ext.Validate(ctx, b2.Filter(about.HandleTypes))
+		fb2, err := filter(b2, about)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = ext.Validate(ctx, fb2)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -131,7 +237,11 @@ func (c *SimpleCaller) Commit(ctx context.Context, amend bool) (bus.Version, err
 	}
 	for _, ext := range exts {
 		about := ext.AboutSelf()
-		err = ext.Validate(ctx, b.Filter(about.HandleTypes))
+		fb, err := filter(b, about)
+		if err != nil {
+			return bus.Version{}, err
+		}
+		err = ext.Validate(ctx, fb)
 		if err != nil {
 			return bus.Version{}, err
 		}
@@ -150,7 +260,15 @@ func (c *SimpleCaller) Generate(ctx context.Context, src bool) error {
 
 	for _, ext := range exts {
 		about := ext.AboutSelf()
-		diff, err := bus.NewDelta(current.Filter(about.HandleTypes), previous.Filter(about.HandleTypes))
+		fc, err := filter(current, about)
+		if err != nil {
+			return err
+		}
+		fp, err := filter(previous, about)
+		if err != nil {
+			return err
+		}
+		diff, err := bus.NewDelta(fc, fp)
 		if err != nil {
 			return err
 		}
@@ -171,7 +289,15 @@ func (c *SimpleCaller) Deploy(ctx context.Context, src bool, opts *DeployOptions
 
 	for _, ext := range exts {
 		about := ext.AboutSelf()
-		diff, err := bus.NewDelta(current.Filter(about.HandleTypes), previous.Filter(about.HandleTypes))
+		fc, err := filter(current, about)
+		if err != nil {
+			return err
+		}
+		fp, err := filter(previous, about)
+		if err != nil {
+			return err
+		}
+		diff, err := bus.NewDelta(fc, fp)
 		if err != nil {
 			return err
 		}
@@ -19,6 +19,7 @@ func NewCRDB() *CRDB {
 }
 
 var _ Extension = &CRDB{}
+var _ LintExtension = &CRDB{}
 
 type CRDB struct{}
 
@@ -33,10 +34,84 @@ func (cr *CRDB) AboutSelf() ExtensionAbout {
 }
 
 // Extension specific Bus validation.
+// Property types and required values are checked when the bus is initialized,
+// this checks the shape of the roles and references the generator relies on.
 func (cr *CRDB) Validate(ctx context.Context, b *bus.Bus) error {
+	var errs *bus.Errors
+	for _, n := range b.NodeByType(typeSQLDatabase, typeSQLTable) {
+		prop := n.Role("prop")
+		if prop == nil || len(prop.Fields) != 1 {
+			errs = errs.Append(fmt.Errorf("crdb: node %q role %q requires exactly one field", n.Name, "prop"))
+			continue
+		}
+		if n.Type != typeSQLTable {
+			continue
+		}
+		sch := n.Role("schema")
+		if sch == nil {
+			errs = errs.Append(fmt.Errorf("crdb: node %q missing role %q", n.Name, "schema"))
+			continue
+		}
+		for i := range sch.Fields {
+			f := &sch.Fields[i]
+			fk, ok := f.Value("fk").(*bus.Node)
+			if !ok {
+				continue
+			}
+			if fk.External() {
+				errs = errs.Append(fmt.Errorf("crdb: node %q field %q references node %q which is not a table", n.Name, f.Name(), fk.Name))
+			}
+		}
+	}
+	if errs != nil {
+		return errs
+	}
 	return nil
 }
 
+// crdbMaxIdentifier is the maximum length in bytes of an identifier.
+const crdbMaxIdentifier = 63
+
+// LintRules returns the CockroachDB specific lint rules.
+func (cr *CRDB) LintRules() []bus.LintRule {
+	return []bus.LintRule{
+		{
+			Name:     "crdb-identifier-length",
+			Usage:    fmt.Sprintf("Database, table, and column names are at most %d bytes.", crdbMaxIdentifier),
+			Severity: bus.SeverityError,
+			Check: func(b *bus.Bus, r *bus.LintReport) {
+				for _, n := range b.NodeByType(typeSQLDatabase, typeSQLTable) {
+					for _, role := range n.Roles {
+						if role.Name != "prop" && role.Name != "schema" {
+							continue
+						}
+						for fi := range role.Fields {
+							name := role.Fields[fi].Name()
+							if len(name) <= crdbMaxIdentifier {
+								continue
+							}
+							r.Report(bus.Location{Node: n.Name, Role: role.Name, Field: fi}, "identifier %q is longer then %d bytes", name, crdbMaxIdentifier)
+						}
+					}
+				}
+			},
+		},
+		{
+			Name:     "crdb-table-comment",
+			Usage:    "Each table has a description, written as the table comment.",
+			Severity: bus.SeverityWarning,
+			Check: func(b *bus.Bus, r *bus.LintReport) {
+				for _, n := range b.NodeByType(typeSQLTable) {
+					if len(strings.TrimSpace(n.Description)) > 0 {
+						continue
+					}
+					r.Report(bus.Location{Node: n.Name, Field: -1}, "table has no comment, set a description")
+				}
+			},
+		},
+	}
+}
+
 // Generate and write files. Note, no file list is provided so extensions should
 // write a manafest file of some type by a well known name.
 func (cr *CRDB) Generate(ctx context.Context, delta *bus.DeltaBus, writeFile ExtensionVersionWriter) error {
@@ -97,7 +172,11 @@ func (cr *CRDB) Generate(ctx context.Context, delta *bus.DeltaBus, writeFile Ext
 		case typeSQLDatabase:
 			prop := n.Role("prop").Fields[0]
 			name := prop.Name()
-			w("create database %[1]s;\nset database = %[1]s;\n\n", name)
+			w("create database %[1]s;\nset database = %[1]s;\n", name)
+			if len(n.Description) > 0 {
+				w("comment on database %s is %s;\n", name, sqlString(n.Description))
+			}
+			w("\n")
 		case typeSQLTable:
 			prop := n.Role("prop").Fields[0]
 			name := prop.Name()
@@ -113,6 +192,9 @@ func (cr *CRDB) Generate(ctx context.Context, delta *bus.DeltaBus, writeFile Ext
 				encodeField(&sch.Fields[i])
 			}
 			w("\n);\n")
+			if len(n.Description) > 0 {
+				w("comment on table %s is %s;\n", name, sqlString(n.Description))
+			}
 		}
 		return nil
 
@@ -129,119 +211,280 @@ func (cr *CRDB) Generate(ctx context.Context, delta *bus.DeltaBus, writeFile Ext
 	}
 	buf.Reset()
 
-	// w("begin transaction;\n")
-
-	for _, alter := range delta.Actions {
-		switch alter.Alter {
+	// renameNode renames the database or table if the name in the prop role changed.
+	renameNode := func(n, nTo *bus.Node) error {
+		name := n.Role("prop").Fields[0].Name()
+		nameTo := nTo.Role("prop").Fields[0].Name()
+		if name == nameTo {
+			return nil
+		}
+		switch n.Type {
 		default:
-			return fmt.Errorf("unknown delta alter: %v", alter.Alter)
-		case bus.AlterNothing:
-			// Nothing.
-		case bus.AlterScript:
-			w("\n%s\n", alter.Script)
-		case bus.AlterNodeAdd:
-			err := createNode(alter.NodeCurrent)
-			if err != nil {
-				return err
-			}
-		case bus.AlterNodeRemove:
-			n := alter.NodePrevious
-			switch n.Type {
-			default:
-				return fmt.Errorf("unknown type: %q", n.Type)
-			case typeSQLDatabase:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Name()
-				w("drop database %[1]s;\n", name)
-			case typeSQLTable:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Name()
-
-				w("drop table %s;\n", name)
-			}
-		case bus.AlterNodeRename:
-			n := alter.NodePrevious
-			nTo := alter.NodeCurrent
-			switch n.Type {
-			default:
-				return fmt.Errorf("unknown type: %q", n.Type)
-			case typeSQLDatabase:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Name()
-				propTo := nTo.Role("prop").Fields[0]
-				nameTo := propTo.Name()
-				w("alter database %s rename to %s;\n", name, nameTo)
-			case typeSQLTable:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Name()
-				propTo := nTo.Role("prop").Fields[0]
-				nameTo := propTo.Name()
-
-				w("alter table %s rename to %s;\n", name, nameTo)
-			}
-		case bus.AlterFieldAdd:
-			n := alter.NodeCurrent
-			switch n.Type {
-			default:
-				return fmt.Errorf("unknown type: %q", n.Type)
-			case typeSQLDatabase:
-				// Nothing.
-			case typeSQLTable:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Name()
+			return fmt.Errorf("unknown type: %q", n.Type)
+		case typeSQLDatabase:
+			w("alter database %s rename to %s;\n", name, nameTo)
+		case typeSQLTable:
+			w("alter table %s rename to %s;\n", name, nameTo)
+		}
+		return nil
+	}
 
-				w("alter table %s add column", name)
-				encodeFieldAttr(alter.FieldCurrent)
-				w(";\n")
-			}
-		case bus.AlterFieldRemove:
-			n := alter.NodeCurrent
-			switch n.Type {
-			default:
-				return fmt.Errorf("unknown type: %q", n.Type)
-			case typeSQLDatabase:
-				// Nothing.
-			case typeSQLTable:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Name()
-				fName := alter.FieldPrevious.Name()
+	// writeActions writes the statements of each action. A statement that
+	// loses data is preceded by a comment so it stands out when reviewed.
+	writeActions := func(actions []bus.DeltaAction) error {
+		// w("begin transaction;\n")
 
-				w("alter table %s drop column %s;\n", name, fName)
-			}
-		case bus.AlterFieldRename:
-			n := alter.NodeCurrent
-			switch n.Type {
+		for _, alter := range actions {
+			switch alter.Alter {
 			default:
-				return fmt.Errorf("unknown type: %q", n.Type)
-			case typeSQLDatabase:
-				w("alter database %s rename to %s;\n", alter.FieldPrevious.Name(), alter.FieldCurrent.Name())
-			case typeSQLTable:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Value("name")
-
-				w("alter table %s rename %s to %s;\n", name, alter.FieldPrevious.Name(), alter.FieldCurrent.Name())
-			}
-		case bus.AlterFieldUpdate:
-			n := alter.NodeCurrent
-			switch n.Type {
-			default:
-				return fmt.Errorf("unknown type: %q", n.Type)
-			case typeSQLDatabase:
+				return fmt.Errorf("unknown delta alter: %v", alter.Alter)
+			case bus.AlterNothing:
 				// Nothing.
-			case typeSQLTable:
-				prop := n.Role("prop").Fields[0]
-				name := prop.Value("name")
+			case bus.AlterScript:
+				w("\n%s\n", alter.Script)
+			case bus.AlterNodeAdd:
+				err := createNode(alter.NodeCurrent)
+				if err != nil {
+					return err
+				}
+			case bus.AlterNodeRemove:
+				n := alter.NodePrevious
+				if alter.DataLoss {
+					w("-- %s\n", alter.String())
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Name()
+					w("drop database %[1]s;\n", name)
+				case typeSQLTable:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Name()
+
+					w("drop table %s;\n", name)
+				}
+			case bus.AlterNodeRename:
+				err := renameNode(alter.NodePrevious, alter.NodeCurrent)
+				if err != nil {
+					return err
+				}
+			case bus.AlterFieldAdd:
+				n := alter.NodeCurrent
+				if alter.Role != "schema" {
+					continue
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					// Nothing.
+				case typeSQLTable:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Name()
 
-				w("alter table %s alter column ", name)
-				encodeFieldAttr(alter.FieldCurrent)
-				w(";\n")
+					w("alter table %s add column ", name)
+					encodeFieldAttr(alter.FieldCurrent)
+					w(";\n")
+				}
+			case bus.AlterFieldRemove:
+				n := alter.NodeCurrent
+				if alter.Role != "schema" {
+					continue
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					// Nothing.
+				case typeSQLTable:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Name()
+					fName := alter.FieldPrevious.Name()
+
+					if alter.DataLoss {
+						w("-- %s\n", alter.String())
+					}
+					w("alter table %s drop column %s;\n", name, fName)
+				}
+			case bus.AlterFieldRename:
+				n := alter.NodeCurrent
+				if alter.Role == "prop" {
+					// A node rename also renames the database or table.
+					if n.Name != alter.NodePrevious.Name {
+						continue
+					}
+					err := renameNode(alter.NodePrevious, n)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				if alter.Role != "schema" {
+					continue
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					// Nothing.
+				case typeSQLTable:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Value("name")
+
+					w("alter table %s rename %s to %s;\n", name, alter.FieldPrevious.Name(), alter.FieldCurrent.Name())
+				}
+			case bus.AlterRoleAdd:
+				// The fields of a role are not added separately, add a column
+				// for each field of an added schema role.
+				n := alter.NodeCurrent
+				if alter.Role != "schema" {
+					continue
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					// Nothing.
+				case typeSQLTable:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Name()
+					sch := n.Role("schema")
+
+					for i := range sch.Fields {
+						w("alter table %s add column ", name)
+						encodeFieldAttr(&sch.Fields[i])
+						w(";\n")
+					}
+				}
+			case bus.AlterRoleRemove:
+				// The fields of a role are not removed separately, drop the
+				// column of each field of a removed schema role.
+				n := alter.NodeCurrent
+				if alter.Role != "schema" {
+					continue
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					// Nothing.
+				case typeSQLTable:
+					prop := n.Role("prop").Fields[0]
+					name := prop.Name()
+					sch := alter.NodePrevious.Role("schema")
+
+					if alter.DataLoss && len(sch.Fields) > 0 {
+						w("-- %s\n", alter.String())
+					}
+					for i := range sch.Fields {
+						w("alter table %s drop column %s;\n", name, sch.Fields[i].Name())
+					}
+				}
+			case bus.AlterFieldReorder:
+				// Nothing, columns keep the order they were added in.
+			case bus.AlterFieldUpdate:
+				n := alter.NodeCurrent
+				if alter.Role != "schema" {
+					continue
+				}
+				switch n.Type {
+				default:
+					return fmt.Errorf("unknown type: %q", n.Type)
+				case typeSQLDatabase:
+					// Nothing.
+				case typeSQLTable:
+					if !columnChanged(alter.Changes) {
+						// Only properties that are not part of the column changed.
+						continue
+					}
+					prop := n.Role("prop").Fields[0]
+					name := prop.Value("name")
+
+					if columnNarrowed(alter.Changes) {
+						w("-- %s (data loss)\n", alter.String())
+					}
+					w("alter table %s alter column ", name)
+					encodeFieldAttr(alter.FieldCurrent)
+					w(";\n")
+				}
 			}
 		}
+
+		// w("commit transaction;\n")
+
+		return nil
 	}
 
-	// w("commit transaction;\n")
+	err = writeActions(delta.Actions)
+	if err != nil {
+		return err
+	}
+	err = writeFile(ctx, "alter.sql", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	buf.Reset()
+
+	// The rollback reverses the delta if a deploy fails. Author scripts
+	// are not reversed, so the rollback notes they were left out.
+	scripts := 0
+	for _, alter := range delta.Actions {
+		if alter.Alter == bus.AlterScript {
+			scripts++
+		}
+	}
+	if scripts > 0 {
+		w("-- Author scripts are not reversed, %d left out. Review the data they changed before running the rollback.\n\n", scripts)
+	}
+	err = writeActions(delta.Invert().Actions)
+	if err != nil {
+		return err
+	}
+	return writeFile(ctx, "rollback.sql", buf.Bytes())
+}
 
-	return writeFile(ctx, "alter.sql", buf.Bytes())
+// sqlString quotes s as an SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// columnProps are the table schema properties that define a column.
+var columnProps = map[string]bool{
+	"type":     true,
+	"length":   true,
+	"nullable": true,
+	"key":      true,
+	"fk":       true,
+}
+
+// columnChanged reports if any change is to a property that defines the column.
+func columnChanged(changes []bus.PropertyChange) bool {
+	for _, c := range changes {
+		if columnProps[c.Key] {
+			return true
+		}
+	}
+	return false
+}
+
+// columnNarrowed reports if a change may not keep every value of the column:
+// a different type, or a length that is set or made smaller.
+func columnNarrowed(changes []bus.PropertyChange) bool {
+	for _, c := range changes {
+		switch c.Key {
+		case "type":
+			return true
+		case "length":
+			prev, _ := c.Previous.(int64)
+			cur, _ := c.Current.(int64)
+			if cur > 0 && (prev == 0 || cur < prev) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Read generated files and deploy to system.
@@ -67,12 +67,25 @@ func TestSQL(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	delta, err := bus.NewDelta(b.Filter(about.HandleTypes), nil)
+	fb, err := filter(b, about)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extcrdb.Validate(ctx, fb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := bus.NewDelta(fb, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// alterSQL is applied before rollback.sql is run.
+	var alterSQL []byte
 	err = extcrdb.Generate(ctx, delta, func(ctx context.Context, filename string, content []byte) error {
+		if filename == "alter.sql" {
+			alterSQL = append([]byte(nil), content...)
+		}
 		t.Run("run SQL", func(t *testing.T) {
 			// If crdb is available, try to create the database script.
 			crdb, err := exec.LookPath("cockroach")
@@ -109,6 +122,12 @@ func TestSQL(t *testing.T) {
 			}
 
 			pool.ExecContext(ctx, "drop database library;")
+			if filename == "rollback.sql" {
+				_, err = pool.ExecContext(ctx, string(alterSQL))
+				if err != nil {
+					t.Fatalf("%v\n\n%s", err, alterSQL)
+				}
+			}
 			_, err = pool.ExecContext(ctx, string(content))
 			if err != nil {
 				switch err := err.(type) {
@@ -142,3 +161,206 @@ func TestSQL(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSQLRename(t *testing.T) {
+	ctx := context.Background()
+
+	extcrdb := NewCRDB()
+	about := extcrdb.AboutSelf()
+
+	loader, err := NewFileBus(filepath.Join(testdata(), "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() *bus.Bus {
+		b, err := loader.GetBus(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	previous, current := load(), load()
+	const from, to = "app1.coredata.biz/n/table/genre", "app1.coredata.biz/n/table/category"
+	err = current.Edit(func(e *bus.Editor) error {
+		if err := e.RenameNode(from, to); err != nil {
+			return err
+		}
+		return e.SetValue(to, "prop", 0, "name", "category")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fprevious, err := filter(previous, about)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcurrent, err := filter(current, about)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := bus.NewDelta(fcurrent, fprevious)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alter, rollback []byte
+	err = extcrdb.Generate(ctx, delta, func(ctx context.Context, filename string, content []byte) error {
+		switch filename {
+		case "alter.sql":
+			alter = append([]byte(nil), content...)
+		case "rollback.sql":
+			rollback = append([]byte(nil), content...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "alter table genre rename to category;\n"
+	if string(alter) != want {
+		t.Fatalf("expected %q, got %q", want, alter)
+	}
+	const wantRollback = "alter table category rename to genre;\n"
+	if string(rollback) != wantRollback {
+		t.Fatalf("expected rollback %q, got %q", wantRollback, rollback)
+	}
+}
+
+func TestSQLRole(t *testing.T) {
+	ctx := context.Background()
+
+	extcrdb := NewCRDB()
+	about := extcrdb.AboutSelf()
+
+	loader, err := NewFileBus(filepath.Join(testdata(), "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loader.GetBus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb, err := filter(b, about)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genre := fb.Node("app1.coredata.biz/n/table/genre")
+	delta := &bus.DeltaBus{
+		Current:  fb,
+		Previous: fb,
+		Actions: []bus.DeltaAction{
+			{Alter: bus.AlterRoleRemove, Role: "schema", NodeCurrent: genre, NodePrevious: genre},
+			{Alter: bus.AlterRoleAdd, Role: "schema", NodeCurrent: genre, NodePrevious: genre},
+		},
+	}
+	var alter []byte
+	err = extcrdb.Generate(ctx, delta, func(ctx context.Context, filename string, content []byte) error {
+		if filename == "alter.sql" {
+			alter = append([]byte(nil), content...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `alter table genre drop column id;
+alter table genre drop column name;
+alter table genre add column id int not null primary key;
+alter table genre add column name string(1000) not null;
+`
+	if string(alter) != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, alter)
+	}
+}
+
+func TestSQLRollback(t *testing.T) {
+	ctx := context.Background()
+
+	extcrdb := NewCRDB()
+	about := extcrdb.AboutSelf()
+
+	loader, err := NewFileBus(filepath.Join(testdata(), "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() *bus.Bus {
+		b, err := loader.GetBus(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	previous, current := load(), load()
+	const genre = "app1.coredata.biz/n/table/genre"
+	err = current.Edit(func(e *bus.Editor) error {
+		return e.SetValue(genre, "schema", 1, "length", 2000)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Scripts = []bus.Script{{Extension: about.Name, From: previous.Version.Sequence, Stage: bus.ScriptAfter, Content: "update genre set name = upper(name);"}}
+	fprevious, err := filter(previous, about)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcurrent, err := filter(current, about)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := bus.NewDelta(fcurrent, fprevious)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	err = extcrdb.Generate(ctx, delta, func(ctx context.Context, filename string, content []byte) error {
+		files[filename] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantAlter = `alter table genre alter column name string(2000) not null;
+
+update genre set name = upper(name);
+`
+	if g := files["alter.sql"]; g != wantAlter {
+		t.Fatalf("alter.sql expected:\n%s\ngot:\n%s", wantAlter, g)
+	}
+	const wantRollback = `-- Author scripts are not reversed, 1 left out. Review the data they changed before running the rollback.
+
+-- field-update node "app1.coredata.biz/n/table/genre" role "schema" field "name": length 2000 -> 1000 (data loss)
+alter table genre alter column name string(1000) not null;
+`
+	if g := files["rollback.sql"]; g != wantRollback {
+		t.Fatalf("rollback.sql expected:\n%s\ngot:\n%s", wantRollback, g)
+	}
+}
+
+func TestCRDBLint(t *testing.T) {
+	ctx := context.Background()
+
+	loader, err := NewFileBus(filepath.Join(testdata(), "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loader.GetBus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := bus.NewLinter()
+	if err = l.Add(NewCRDB().LintRules()...); err != nil {
+		t.Fatal(err)
+	}
+	errs, err := l.Lint(b, bus.LintConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []string
+	for _, d := range errs.List {
+		if d.Code == bus.LintCode("crdb-table-comment") {
+			nodes = append(nodes, d.Node)
+		}
+	}
+	if len(nodes) != 1 || nodes[0] != "app1.coredata.biz/n/table/book" {
+		t.Fatalf("expected a missing table comment on book, got %q", nodes)
+	}
+}
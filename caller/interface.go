@@ -10,6 +10,14 @@ import (
 type ExtensionAbout struct {
 	Name        string
 	HandleTypes []string
+
+	// Side of the handled node types the extension reads.
+	// Defaults to both sides.
+	Side bus.Side
+
+	// Context includes the nodes the handled nodes refer to as read-only
+	// nodes, see bus.FilterOptions.Closure.
+	Context bool
 }
 
 type Extension interface {
@@ -42,6 +50,17 @@ type BusReader interface {
 	GetBus(ctx context.Context) (*bus.Bus, error)
 }
 
+// Read the project configuration.
+type ConfigReader interface {
+	GetConfig(ctx context.Context) (*Config, error)
+}
+
+// Config is the project configuration read from the project config file.
+type Config struct {
+	// Lint configures the lint rules run by the lint command.
+	Lint bus.LintConfig
+}
+
 // Read or write the bus or delta bus definitions at a given version.
 type BusVersioner interface {
 	List(ctx context.Context) ([]bus.Version, error)
@@ -62,6 +81,14 @@ type ExtensionVersionReader func(ctx context.Context, path string) ([]byte, erro
 // Used by an extension to write a given file.
 type ExtensionVersionWriter func(ctx context.Context, path string, content []byte) error
 
+// LintExtension is an Extension that provides lint rules in addition to the
+// built-in bus lint rules. The rules are run on the unfiltered bus.
+type LintExtension interface {
+	Extension
+
+	LintRules() []bus.LintRule
+}
+
 type ExtensionRegister interface {
 	List(ctx context.Context) ([]string, error)
 	Get(ctx context.Context, name string) (Extension, error)
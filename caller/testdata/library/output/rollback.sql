@@ -0,0 +1,6 @@
+-- node-remove node "app1.coredata.biz/n/table/book" (data loss)
+drop table book;
+-- node-remove node "app1.coredata.biz/n/table/genre" (data loss)
+drop table genre;
+-- node-remove node "app1.coredata.biz/n/database" (data loss)
+drop database library;
@@ -5,6 +5,7 @@ create table genre (
 	id int not null primary key,
 	name string(1000) not null
 );
+comment on table genre is 'Genre of a book, such as fiction.';
 create table book (
 	id int not null primary key,
 	name string(1000) not null,
@@ -10,3 +10,11 @@ Enteries: [
 		}
 	},
 ]
+Lint: {
+	Rules: {
+		"crdb-table-comment": "off"
+	}
+	Select: {
+		"crdb-identifier-length": "type=solidcoredata.org/t/db/table/schema"
+	}
+}
@@ -19,6 +19,8 @@ db :: [
 		Name: "app1.coredata.biz/n/table/genre"
 		NameAlt: []
 		Type: "solidcoredata.org/t/db/table"
+		Description: "Genre of a book, such as fiction."
+		Owner: "library"
 		Binds: []
 		Roles: [
 			{
@@ -2,7 +2,6 @@ package caller
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,6 +24,7 @@ const (
 
 var _ BusVersioner = &FileBus{}
 var _ BusReader = &FileBus{}
+var _ ConfigReader = &FileBus{}
 
 func NewFileBus(projectRoot string) (*FileBus, error) {
 	return &FileBus{
@@ -70,45 +70,57 @@ func (fb *FileBus) List(ctx context.Context) ([]bus.Version, error) {
 	})
 	return vv, nil
 }
-func (fb *FileBus) Get(ctx context.Context, bv bus.Version) (*bus.Bus, error) {
-	p := ""
+
+// resolve a relative version sequence (zero or negative) to the absolute version sequence.
+func (fb *FileBus) resolve(ctx context.Context, bv bus.Version) (bus.Version, error) {
 	switch {
 	case bv.Sequence == 0:
 		list, err := fb.List(ctx)
 		if err != nil {
-			return nil, err
+			return bv, err
 		}
 		if len(list) == 0 {
-			return nil, fmt.Errorf("inter: cannot read current version, no current version exists")
+			return bv, fmt.Errorf("inter: cannot read current version, no current version exists")
 		}
-		v := list[len(list)-1]
-		p = filepath.Join(fb.root, versionDir, strconv.FormatInt(v.Sequence, 10), versionFilename)
+		return list[len(list)-1], nil
 	case bv.Sequence < 0:
 		list, err := fb.List(ctx)
 		if err != nil {
-			return nil, err
+			return bv, err
 		}
 		nFromCurrent := -bv.Sequence
 		if int64(len(list)) < nFromCurrent+1 {
-			return nil, fmt.Errorf("inter: cannot read %d version, requested version does not exists", bv.Sequence)
+			return bv, fmt.Errorf("inter: cannot read %d version, requested version does not exists", bv.Sequence)
 		}
-		v := list[int64(len(list))-1-nFromCurrent]
-		p = filepath.Join(fb.root, versionDir, strconv.FormatInt(v.Sequence, 10), versionFilename)
-	case bv.Sequence > 0:
-		p = filepath.Join(fb.root, versionDir, strconv.FormatInt(bv.Sequence, 10), versionFilename)
+		return list[int64(len(list))-1-nFromCurrent], nil
 	default:
-		panic("can't happen")
+		return bv, nil
 	}
+}
+
+func (fb *FileBus) Get(ctx context.Context, bv bus.Version) (*bus.Bus, error) {
+	v, err := fb.resolve(ctx, bv)
+	if err != nil {
+		return nil, err
+	}
+	p := filepath.Join(fb.root, versionDir, strconv.FormatInt(v.Sequence, 10), versionFilename)
 	bus, err := load.Bus(ctx, p)
 	if err != nil {
 		return nil, err
 	}
+	if err = bus.VerifyIdentifier(); err != nil {
+		return nil, fmt.Errorf("inter: %q %w", p, err)
+	}
 	return bus, bus.Init()
 }
 func (fb *FileBus) Amend(ctx context.Context, existing bus.Version, b *bus.Bus) (bus.Version, error) {
+	v, err := fb.resolve(ctx, existing)
+	if err != nil {
+		return bus.Version{}, err
+	}
 	x := *b
-	x.Version = existing
-	err := fb.writeBus(ctx, &x)
+	x.Version = bus.Version{Sequence: v.Sequence}
+	err = fb.writeBus(ctx, &x)
 	return x.Version, err
 }
 func (fb *FileBus) Commit(ctx context.Context, b *bus.Bus) (bus.Version, error) {
@@ -126,7 +138,14 @@ func (fb *FileBus) Commit(ctx context.Context, b *bus.Bus) (bus.Version, error)
 	return x.Version, err
 }
 
+// writeBus sets the bus version identifier and writes the bus to the version directory.
 func (fb *FileBus) writeBus(ctx context.Context, b *bus.Bus) error {
+	id, err := b.Hash()
+	if err != nil {
+		return err
+	}
+	b.Version.Identifier = id
+
 	vdir := filepath.Join(fb.root, versionDir, strconv.FormatInt(b.Version.Sequence, 10))
 	if err := os.MkdirAll(vdir, 0700); err != nil {
 		return err
@@ -137,10 +156,7 @@ func (fb *FileBus) writeBus(ctx context.Context, b *bus.Bus) error {
 		return err
 	}
 	defer f.Close()
-	coder := json.NewEncoder(f)
-	coder.SetEscapeHTML(false)
-	coder.SetIndent("", "\t")
-	return coder.Encode(b)
+	return b.EncodeCanonical(f)
 }
 
 func (fb *FileBus) GetBus(ctx context.Context) (*bus.Bus, error) {
@@ -151,3 +167,13 @@ func (fb *FileBus) GetBus(ctx context.Context) (*bus.Bus, error) {
 	}
 	return bus, bus.Init()
 }
+
+func (fb *FileBus) GetConfig(ctx context.Context) (*Config, error) {
+	p := filepath.Join(fb.root, ConfigFilename)
+	config := &Config{}
+	err := load.Decode(ctx, p, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
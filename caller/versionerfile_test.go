@@ -0,0 +1,118 @@
+package caller
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitIdentifier(t *testing.T) {
+	ctx := context.Background()
+
+	src, err := NewFileBus(filepath.Join(testdata(), "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := src.GetBus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	fb, err := NewFileBus(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ver, err := fb.Commit(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver.Sequence != 1 {
+		t.Fatalf("expected sequence 1, got %d", ver.Sequence)
+	}
+	var zero [64]byte
+	if ver.Identifier == zero {
+		t.Fatal("expected identifier to be set")
+	}
+
+	got, err := fb.Get(ctx, ver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version.Identifier != ver.Identifier {
+		t.Fatal("loaded identifier does not match committed identifier")
+	}
+
+	amend, err := fb.Amend(ctx, got.Version, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amend.Sequence != ver.Sequence || amend.Identifier != ver.Identifier {
+		t.Fatalf("amend of same content changed version: %v", amend)
+	}
+
+	// Alter the content and ensure the load fails.
+	p := filepath.Join(root, versionDir, "1", versionFilename)
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	altered := []byte(strings.Replace(string(content), "library", "library2", 1))
+	err = ioutil.WriteFile(p, altered, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fb.Get(ctx, ver)
+	if err == nil {
+		t.Fatal("expected identifier mismatch error")
+	}
+
+	// Clear the identifier and ensure the load fails.
+	id := hex.EncodeToString(ver.Identifier[:])
+	cleared := []byte(strings.Replace(string(content), id, strings.Repeat("0", len(id)), 1))
+	err = ioutil.WriteFile(p, cleared, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fb.Get(ctx, ver)
+	if err == nil {
+		t.Fatal("expected missing identifier error")
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	ctx := context.Background()
+
+	fb, err := NewFileBus(filepath.Join(testdata(), "library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := fb.GetConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Lint.Rules["crdb-table-comment"]; got != "off" {
+		t.Fatalf("expected crdb-table-comment to be off, got %q", got)
+	}
+	if got := config.Lint.Select["crdb-identifier-length"]; got != "type=solidcoredata.org/t/db/table/schema" {
+		t.Fatalf("expected crdb-identifier-length to select table schemas, got %q", got)
+	}
+	reg := NewBuiltinExtentionRegister()
+	if err = reg.Add(ctx, NewCRDB()); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCaller(CallerSetup{Bus: fb, Config: fb, Versioner: fb, ExtReg: reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := c.Lint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs != nil {
+		t.Fatalf("expected no lint findings, got %v", errs)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"solidcoredata.org/src/databus/bus"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// checkFormat returns an error if format is not one of the allowed formats
+// of the command.
+func checkFormat(format string, allowed ...string) error {
+	for _, a := range allowed {
+		if format == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q, must be one of %q", format, allowed)
+}
+
+// writeDiagnostics writes the diagnostics in err to w in the given format.
+// Errors that are not bus diagnostics are written as a single diagnostic.
+func writeDiagnostics(w io.Writer, format string, err error) error {
+	var errs *bus.Errors
+	if err != nil && !errors.As(err, &errs) {
+		errs = errs.Append(err)
+	}
+	switch format {
+	default:
+		return fmt.Errorf("unknown format %q, must be one of %q or %q", format, formatText, formatJSON)
+	case formatText:
+		if errs == nil {
+			return nil
+		}
+		for _, d := range errs.List {
+			fmt.Fprintf(w, "%s: %s [%s]\n", d.Severity, d.Error(), d.Code)
+		}
+		return nil
+	case formatJSON:
+		coder := json.NewEncoder(w)
+		coder.SetEscapeHTML(false)
+		coder.SetIndent("", "\t")
+		return coder.Encode(errs)
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"solidcoredata.org/src/databus/bus"
 	"solidcoredata.org/src/databus/caller"
 
 	"github.com/kardianos/task"
@@ -23,6 +26,10 @@ func main() {
 
 func run(ctx context.Context) error {
 	fProject := &task.Flag{Name: "project", Type: task.FlagString, Default: "", Usage: "Project directory, if empty, uses current working directory."}
+	// Each command has a single format flag, the meaning of which differs by command.
+	fDiagFormat := &task.Flag{Name: "format", Type: task.FlagString, Default: formatText, Usage: "Diagnostic output format, either text or json."}
+	fDiffFormat := &task.Flag{Name: "format", Type: task.FlagString, Default: string(bus.DiffText), Usage: "Diff output format, either text, json, or unified."}
+	fGraphFormat := &task.Flag{Name: "format", Type: task.FlagString, Default: string(bus.GraphDOT), Usage: "Graph format, either dot or mermaid."}
 	fSrc := &task.Flag{Name: "src", Type: task.FlagBool, Default: false, Usage: "True if the src should be used as the current version and the most recent checkin the previous version."}
 
 	extReg := caller.NewBuiltinExtentionRegister()
@@ -47,6 +54,7 @@ func run(ctx context.Context) error {
 		}
 		return caller.NewCaller(caller.CallerSetup{
 			Bus:       fb,
+			Config:    fb,
 			Versioner: fb,
 			ExtRW:     rwext,
 			ExtReg:    extReg,
@@ -65,22 +73,117 @@ The source for the current input bus should live under %q.
 			{
 				Name:  "validate",
 				Usage: "Validate the data bus.",
+				Flags: []*task.Flag{fDiagFormat},
 				Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
 					project := st.Default(fProject.Name, "").(string)
+					format := st.Default(fDiagFormat.Name, fDiagFormat.Default).(string)
+					if err := checkFormat(format, formatText, formatJSON); err != nil {
+						return err
+					}
+					c, err := setupSystem(project)
+					if err != nil {
+						return err
+					}
+					warnings, verr := c.Validate(ctx)
+					if verr != nil {
+						err = writeDiagnostics(st.Stdout, format, verr)
+						if err != nil {
+							return err
+						}
+						return errors.New("validation failed")
+					}
+					return writeDiagnostics(st.Stdout, format, warnings)
+				}),
+			},
+			{
+				Name:  "lint",
+				Usage: fmt.Sprintf("Lint the data bus with the built-in and extension lint rules, configured in %q.", caller.ConfigFilename),
+				Flags: []*task.Flag{fDiagFormat},
+				Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+					project := st.Default(fProject.Name, "").(string)
+					format := st.Default(fDiagFormat.Name, fDiagFormat.Default).(string)
+					if err := checkFormat(format, formatText, formatJSON); err != nil {
+						return err
+					}
+					c, err := setupSystem(project)
+					if err != nil {
+						return err
+					}
+					errs, err := c.Lint(ctx)
+					if err != nil {
+						return err
+					}
+					err = writeDiagnostics(st.Stdout, format, errs)
+					if err != nil {
+						return err
+					}
+					if errs.HasError() {
+						return errors.New("lint failed")
+					}
+					return nil
+				}),
+			},
+			{
+				Name:  "query",
+				Usage: "Query the data bus with a selector, such as: type=solidcoredata.org/t/db/table/schema[key=true]",
+				Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+					project := st.Default(fProject.Name, "").(string)
+					args, _ := st.Get("args").([]string)
+					if len(args) != 1 {
+						return errors.New("query requires a single selector argument")
+					}
+					c, err := setupSystem(project)
+					if err != nil {
+						return err
+					}
+					list, err := c.Query(ctx, args[0])
+					if err != nil {
+						return err
+					}
+					for _, m := range list {
+						st.Log(m.String())
+					}
+					return nil
+				}),
+			},
+			{
+				Name:  "graph",
+				Usage: "Write the node dependency graph of the src data bus as Graphviz DOT or Mermaid.",
+				Flags: []*task.Flag{
+					fGraphFormat,
+					{Name: "type", Type: task.FlagString, Default: "", Usage: "Comma separated node types to include, if empty, includes all nodes."},
+					{Name: "changes", Type: task.FlagBool, Default: false, Usage: "Highlight the nodes changed since the most recent commit."},
+				},
+				Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
+					project := st.Default(fProject.Name, "").(string)
+					format := st.Default(fGraphFormat.Name, fGraphFormat.Default).(string)
+					if err := checkFormat(format, string(bus.GraphDOT), string(bus.GraphMermaid)); err != nil {
+						return err
+					}
+					opts := bus.GraphOptions{
+						Format: bus.GraphFormat(format),
+					}
+					if types := st.Default("type", "").(string); len(types) > 0 {
+						opts.Types = strings.Split(types, ",")
+					}
 					c, err := setupSystem(project)
 					if err != nil {
 						return err
 					}
-					return c.Validate(ctx)
+					return c.Graph(ctx, st.Stdout, opts, st.Default("changes", false).(bool))
 				}),
 			},
 			{
 				Name:  "diff",
 				Usage: "Show the current diff between the current src data bus and current bus.",
-				Flags: []*task.Flag{fSrc},
+				Flags: []*task.Flag{fSrc, fDiffFormat},
 				Action: task.ActionFunc(func(ctx context.Context, st *task.State, sc task.Script) error {
 					project := st.Default(fProject.Name, "").(string)
 					src := st.Default(fSrc.Name, false).(bool)
+					format := st.Default(fDiffFormat.Name, fDiffFormat.Default).(string)
+					if err := checkFormat(format, string(bus.DiffText), string(bus.DiffJSON), string(bus.DiffUnified)); err != nil {
+						return err
+					}
 					c, err := setupSystem(project)
 					if err != nil {
 						return err
@@ -89,8 +192,7 @@ The source for the current input bus should live under %q.
 					if err != nil {
 						return err
 					}
-					st.Log(diff.String())
-					return nil
+					return diff.Write(st.Stdout, bus.DiffFormat(format))
 				}),
 			},
 			{